@@ -0,0 +1,230 @@
+package gfmrun
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCache stores the results of passing examples by a hash of everything
+// that their results depend on, so that unchanged examples are not run again
+type resultCache struct {
+	Dir string
+
+	dirHashesLock sync.Mutex
+	dirHashes     map[string]string
+}
+
+// cachedResult is the part of a passing result that is stored in the cache
+type cachedResult struct {
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Duration time.Duration `json:"duration"`
+}
+
+func newResultCache(dir string) *resultCache {
+	if dir == "" {
+		return nil
+	}
+
+	return &resultCache{Dir: dir, dirHashes: map[string]string{}}
+}
+
+// Key hashes the example source, tags, frob commands, toolchain executables,
+// and the files the example reads, such as fixtures and golden files
+func (c *resultCache) Key(rn *Runnable) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "gfmrun %s\n", VersionString)
+
+	sourceFile, err := filepath.Abs(rn.SourceFile)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(h, "example %s:%d %s\n", sourceFile, rn.LineOffset, rn.Lang)
+	fmt.Fprintf(h, "frob %T\n", rn.Frob)
+	fmt.Fprintf(h, "tags %s\n", rn.RawTags)
+	fmt.Fprintf(h, "clean_env %v\n", rn.cleanEnv)
+	fmt.Fprintf(h, "timeout %v\n", rn.defaultTimeout)
+	fmt.Fprintf(h, "wrap %v\n", rn.defaultWrap)
+	fmt.Fprintf(h, "go_flags %q\n", rn.goFlags)
+
+	source, err := rn.transformedSource()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(h, "source %q\n", source)
+	fmt.Fprintf(h, "stdin_block %q\n", rn.StdinBlock)
+	fmt.Fprintf(h, "output_block %q\n", rn.OutputBlock)
+
+	for _, part := range rn.GroupFiles {
+		fmt.Fprintf(h, "group_file %q %q\n", part.RawTags, part.String())
+	}
+
+	for _, cmd := range rn.Frob.Commands(rn) {
+		fmt.Fprintf(h, "command %v %q %q\n", cmd.Main, cmd.Args, cmd.Dir)
+
+		if len(cmd.Args) > 0 && !strings.Contains(cmd.Args[0], "{{") {
+			hashExecutable(h, cmd.Args[0])
+		}
+	}
+
+	fixtures, err := rn.Fixtures()
+	if err != nil {
+		return "", err
+	}
+
+	for _, fx := range fixtures {
+		fmt.Fprintf(h, "fixture %q %q\n", fx.Name, fx.Content)
+
+		if fx.Path != "" {
+			fmt.Fprintf(h, "fixture_path %s\n", c.hashDir(fx.Path, nil))
+		}
+	}
+
+	rn.parseTags()
+
+	for _, tag := range []string{"stdin_file", "output_file"} {
+		if s, ok := rn.Tags[tag].(string); ok && s != "" {
+			fmt.Fprintf(h, "%s %s\n", tag, c.hashDir(rn.sourceRelativePath(s), nil))
+		}
+	}
+
+	// the local modules that Go examples are built against
+	if _, ok := rn.Frob.(*GoFrob); ok {
+		for _, replacement := range goReplacements(rn.SourceFile, rn.goReplace) {
+			_, replacePath, _ := strings.Cut(replacement, "=")
+			if filepath.IsAbs(replacePath) {
+				fmt.Fprintf(h, "go_replace %s %s\n", replacement, c.hashDir(replacePath, isGoModuleFile))
+			}
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Get returns the result stored for the key, or nil when there is none
+func (c *resultCache) Get(key string) *cachedResult {
+	entryBytes, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+
+	entry := &cachedResult{}
+	if err := json.Unmarshal(entryBytes, entry); err != nil {
+		return nil
+	}
+
+	return entry
+}
+
+// Put stores the result for the key
+func (c *resultCache) Put(key string, res *Result) error {
+	entryBytes, err := json.Marshal(&cachedResult{
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+		Duration: res.Duration,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path(key)), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path(key), entryBytes, os.FileMode(0644))
+}
+
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+// hashDir hashes the names and contents of the file or the files within the
+// directory at path that match the filter, skipping hidden directories, and
+// remembers the hash for the rest of the run
+func (c *resultCache) hashDir(path string, filter func(string) bool) string {
+	c.dirHashesLock.Lock()
+	defer c.dirHashesLock.Unlock()
+
+	cacheKey := fmt.Sprintf("%s %v", path, filter != nil)
+	if sum, ok := c.dirHashes[cacheKey]; ok {
+		return sum
+	}
+
+	h := sha256.New()
+	files := []string{}
+
+	_ = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Fprintf(h, "error %q\n", err.Error())
+			return nil
+		}
+
+		if info.IsDir() {
+			if p != path && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filter == nil || filter(p) {
+			files = append(files, p)
+		}
+
+		return nil
+	})
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		fmt.Fprintf(h, "file %s\n", file)
+
+		if f, err := os.Open(file); err == nil {
+			_, _ = io.Copy(h, f)
+			_ = f.Close()
+		}
+	}
+
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+	c.dirHashes[cacheKey] = sum
+	return sum
+}
+
+func isGoModuleFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, ".go") || base == "go.mod" || base == "go.sum"
+}
+
+// hashExecutable identifies the version of a toolchain by the path, size, and
+// modification time of its executable
+func hashExecutable(h hash.Hash, name string) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		fmt.Fprintf(h, "executable %s missing\n", name)
+		return
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(h, "executable %s missing\n", name)
+		return
+	}
+
+	fmt.Fprintf(h, "executable %s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+}
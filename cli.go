@@ -2,11 +2,9 @@ package gfmrun
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"sort"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -55,6 +53,70 @@ func NewCLI() *cli.App {
 				Usage:   "disable automatic pull of languages.yml when missing",
 				EnvVars: []string{"GFMRUN_NO_AUTO_PULL", "NO_AUTO_PULL"},
 			},
+			&cli.IntFlag{
+				Name:    "jobs",
+				Aliases: []string{"j"},
+				Usage:   "maximum number of examples per source to run concurrently",
+				Value:   1,
+				EnvVars: []string{"GFMRUN_JOBS", "JOBS"},
+			},
+			&cli.DurationFlag{
+				Name:    "timeout",
+				Aliases: []string{"t"},
+				Usage:   "default maximum duration of each example (no limit when 0)",
+				EnvVars: []string{"GFMRUN_TIMEOUT", "TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "junit-report",
+				Usage:   "write a JUnit XML report of the example results to this path",
+				EnvVars: []string{"GFMRUN_JUNIT_REPORT", "JUNIT_REPORT"},
+			},
+			&cli.BoolFlag{
+				Name:    "json",
+				Usage:   "write a stream of JSON events compatible with `go test -json` tooling to stdout",
+				EnvVars: []string{"GFMRUN_JSON"},
+			},
+			&cli.BoolFlag{
+				Name:    "update",
+				Aliases: []string{"u"},
+				Usage:   "rewrite the golden files of \"output_file\" tags from actual output",
+				EnvVars: []string{"GFMRUN_UPDATE"},
+			},
+			&cli.BoolFlag{
+				Name:    "clean-env",
+				Usage:   "run examples with a minimal environment (PATH, HOME, TMPDIR, Go caches, etc.)",
+				EnvVars: []string{"GFMRUN_CLEAN_ENV"},
+			},
+			&cli.BoolFlag{
+				Name:    "shell-sessions",
+				Usage:   "run console transcripts of \"$ \" prompts and their expected output",
+				EnvVars: []string{"GFMRUN_SHELL_SESSIONS"},
+			},
+			&cli.BoolFlag{
+				Name:    "go-wrap",
+				Usage:   "wrap Go snippets that are not a main package and type check other packages",
+				EnvVars: []string{"GFMRUN_GO_WRAP"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "go-replace",
+				Usage:   "add a `module=path` replace directive to the go.mod of Go examples",
+				EnvVars: []string{"GFMRUN_GO_REPLACE"},
+			},
+			&cli.StringFlag{
+				Name:    "go-flags",
+				Usage:   "space-separated (and optionally quoted) `flags` given to the go tool when building Go examples, e.g. \"-race -tags=integration\"",
+				EnvVars: []string{"GFMRUN_GO_FLAGS"},
+			},
+			&cli.BoolFlag{
+				Name:    "go-isolate",
+				Usage:   "build each Go example as a module of its own instead of sharing one per source",
+				EnvVars: []string{"GFMRUN_GO_ISOLATE"},
+			},
+			&cli.BoolFlag{
+				Name:    "no-cache",
+				Usage:   "run every example instead of reusing cached results of unchanged examples",
+				EnvVars: []string{"GFMRUN_NO_CACHE"},
+			},
 			&cli.BoolFlag{
 				Name:    "debug",
 				Aliases: []string{"D"},
@@ -109,6 +171,23 @@ func NewCLI() *cli.App {
 }
 
 func RunExamples(sources []string, expectedCount int, languagesFile string, autoPull bool, log *logrus.Logger) error {
+	_, err := RunExamplesReport(sources, expectedCount, languagesFile, autoPull, log)
+	return err
+}
+
+// RunExamplesReport is like RunExamples, but also returns the report of all
+// example results, which is nil only if the examples could not be run at all
+func RunExamplesReport(sources []string, expectedCount int, languagesFile string, autoPull bool, log *logrus.Logger) (*Report, error) {
+	runner, err := newExamplesRunner(sources, expectedCount, languagesFile, autoPull, log)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := runner.RunReport()
+	return rep, rep.Err()
+}
+
+func newExamplesRunner(sources []string, expectedCount int, languagesFile string, autoPull bool, log *logrus.Logger) (*Runner, error) {
 	if sources == nil {
 		sources = []string{}
 	}
@@ -117,22 +196,7 @@ func RunExamples(sources []string, expectedCount int, languagesFile string, auto
 		log = logrus.New()
 	}
 
-	runner, err := NewRunner(sources, expectedCount, languagesFile, autoPull, log)
-	if err != nil {
-		return err
-	}
-
-	errs := runner.Run()
-
-	if len(errs) > 0 {
-		msg := make([]string, len(errs))
-		for i, err := range errs {
-			msg[i] = err.Error()
-		}
-		return errors.New(strings.Join(msg, "\n"))
-	}
-
-	return nil
+	return NewRunner(sources, expectedCount, languagesFile, autoPull, log)
 }
 
 func ExtractExamples(sources []string, outDir, languagesFile string, autoPull bool, log *logrus.Logger) error {
@@ -164,17 +228,8 @@ func ExtractExamples(sources []string, outDir, languagesFile string, autoPull bo
 
 	runner.noExec = true
 	runner.extractDir = outDir
-	errs := runner.Run()
-
-	if len(errs) > 0 {
-		msg := make([]string, len(errs))
-		for i, err := range errs {
-			msg[i] = err.Error()
-		}
-		return errors.New(strings.Join(msg, "\n"))
-	}
 
-	return nil
+	return joinErrors(runner.Run())
 }
 
 func cliRunExamples(ctx *cli.Context) error {
@@ -183,14 +238,44 @@ func cliRunExamples(ctx *cli.Context) error {
 		log.Level = logrus.DebugLevel
 	}
 
-	err := RunExamples(ctx.StringSlice("sources"), ctx.Int("count"),
+	runner, err := newExamplesRunner(ctx.StringSlice("sources"), ctx.Int("count"),
 		ctx.String("languages"), ctx.Bool("no-auto-pull"), log)
+	if err != nil {
+		log.Error(err)
+		return cli.Exit("", 2)
+	}
 
+	goFlags, err := splitGoFlags(ctx.String("go-flags"))
 	if err != nil {
 		log.Error(err)
 		return cli.Exit("", 2)
 	}
 
+	runner.Concurrency = ctx.Int("jobs")
+	runner.Timeout = ctx.Duration("timeout")
+	runner.JUnitReport = ctx.String("junit-report")
+	runner.UpdateGolden = ctx.Bool("update")
+	runner.CleanEnv = ctx.Bool("clean-env")
+	runner.GoWrap = ctx.Bool("go-wrap")
+	runner.ShellSessions = ctx.Bool("shell-sessions")
+	runner.GoReplace = ctx.StringSlice("go-replace")
+	runner.GoFlags = goFlags
+	runner.GoIsolate = ctx.Bool("go-isolate")
+	runner.NoCache = ctx.Bool("no-cache")
+
+	if ctx.Bool("json") {
+		runner.JSONEvents = os.Stdout
+	}
+
+	if err := joinErrors(runner.RunContext(ctx.Context)); err != nil {
+		if shouldColorize(os.Stderr) {
+			log.Error(colorizeDiff(err.Error()))
+		} else {
+			log.Error(err)
+		}
+		return cli.Exit("", 2)
+	}
+
 	return nil
 }
 
@@ -203,7 +288,13 @@ func cliListFrobs(ctx *cli.Context) error {
 	known := map[string]bool{}
 
 	for name := range DefaultFrobs {
-		for _, alias := range langs.Lookup(name).Aliases {
+		lang := langs.Lookup(name)
+		if lang == nil {
+			known[name] = true
+			continue
+		}
+
+		for _, alias := range lang.Aliases {
 			known[alias] = true
 		}
 	}
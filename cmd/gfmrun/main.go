@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/gfmrun"
 )
 
 func main() {
-	err := gfmrun.NewCLI().Run(os.Args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := gfmrun.NewCLI().RunContext(ctx, os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
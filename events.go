@@ -0,0 +1,142 @@
+package gfmrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// testEvent is modeled on the events emitted by `go test -json` (see `go doc
+// cmd/test2json`), with the markdown source used as the package and the
+// example name used as the test, plus a few gfmrun-specific fields
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string  `json:",omitempty"`
+	Test    string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"`
+	Output  string  `json:",omitempty"`
+	Source  string  `json:",omitempty"`
+	Line    int     `json:",omitempty"`
+	Lang    string  `json:",omitempty"`
+}
+
+type eventEmitter struct {
+	enc *json.Encoder
+}
+
+func newEventEmitter(w io.Writer) *eventEmitter {
+	if w == nil {
+		return nil
+	}
+
+	return &eventEmitter{enc: json.NewEncoder(w)}
+}
+
+func (em *eventEmitter) emit(ev *testEvent) {
+	if em == nil {
+		return
+	}
+
+	ev.Time = time.Now()
+	_ = em.enc.Encode(ev)
+}
+
+func newRunnableEvent(action string, rn *Runnable) *testEvent {
+	return &testEvent{
+		Action:  action,
+		Package: rn.SourceFile,
+		Test:    rn.Name(),
+		Source:  rn.SourceFile,
+		Line:    rn.LineOffset,
+		Lang:    rn.Lang,
+	}
+}
+
+func (em *eventEmitter) SourceStart(sourceName string) {
+	em.emit(&testEvent{Action: "start", Package: sourceName, Source: sourceName})
+}
+
+func (em *eventEmitter) SourceFinish(sourceName string, res []*Result, dur time.Duration) {
+	action := "pass"
+	if len(res) == 0 {
+		action = "skip"
+	}
+
+	for _, result := range res {
+		if result != nil && result.Status == StatusFail {
+			action = "fail"
+			break
+		}
+	}
+
+	em.emit(&testEvent{
+		Action:  action,
+		Package: sourceName,
+		Source:  sourceName,
+		Elapsed: dur.Seconds(),
+	})
+}
+
+func (em *eventEmitter) RunnableStart(rn *Runnable) {
+	if em == nil {
+		return
+	}
+
+	em.emit(newRunnableEvent("run", rn))
+}
+
+func (em *eventEmitter) RunnableOutput(rn *Runnable, output string) {
+	if em == nil {
+		return
+	}
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		ev := newRunnableEvent("output", rn)
+		ev.Output = line
+		em.emit(ev)
+	}
+}
+
+func (em *eventEmitter) RunnableFinish(result *Result) {
+	if em == nil {
+		return
+	}
+
+	rn := result.Runnable
+	action, status := "pass", "PASS"
+	detail := ""
+
+	switch v := result.Error.(type) {
+	case nil:
+	case *SkipError:
+		action, status = "skip", "SKIP"
+		detail = v.Reason
+	default:
+		action, status = "fail", "FAIL"
+		detail = v.Error()
+	}
+
+	em.RunnableOutput(rn, result.Stdout)
+	em.RunnableOutput(rn, result.Stderr)
+	elapsed := fmt.Sprintf("%.2fs", result.Duration.Seconds())
+	if result.Cached {
+		elapsed = "cached"
+	}
+
+	em.RunnableOutput(rn, fmt.Sprintf("--- %s: %s (%s)\n", status, rn.Name(), elapsed))
+
+	if detail != "" {
+		em.RunnableOutput(rn, "    "+strings.ReplaceAll(strings.TrimRight(detail, "\n"), "\n", "\n    ")+"\n")
+	}
+
+	ev := newRunnableEvent(action, rn)
+	ev.Elapsed = result.Duration.Seconds()
+	em.emit(ev)
+}
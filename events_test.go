@@ -0,0 +1,48 @@
+package gfmrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventEmitter_RunnableFinish(t *testing.T) {
+	buf := &bytes.Buffer{}
+	events := newEventEmitter(buf)
+
+	rn := NewRunnable("README.md", testLog)
+	rn.LineOffset = 42
+	rn.Lang = "go"
+
+	events.RunnableStart(rn)
+	events.RunnableFinish(&Result{
+		Runnable: rn,
+		Stdout:   "one\ntwo\n",
+		Error:    errors.New("exit status 1"),
+		Duration: time.Second,
+	})
+
+	actions := []string{}
+	outputs := []string{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		ev := &testEvent{}
+		assert.Nil(t, json.Unmarshal([]byte(line), ev))
+		assert.Equal(t, "README.md", ev.Package)
+		assert.Equal(t, "README.md:L42-go", ev.Test)
+		assert.Equal(t, 42, ev.Line)
+
+		actions = append(actions, ev.Action)
+		outputs = append(outputs, ev.Output)
+	}
+
+	assert.Equal(t, []string{"run", "output", "output", "output", "output", "fail"}, actions)
+	assert.Equal(t, "one\n", outputs[1])
+	assert.Equal(t, "--- FAIL: README.md:L42-go (1.00s)\n", outputs[3])
+	assert.Equal(t, "    exit status 1\n", outputs[4])
+}
@@ -0,0 +1,202 @@
+package gfmrun
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fixture is a file (or directory) from the "files" tag that is written to
+// the temporary directory of an example before its commands are run
+type fixture struct {
+	Name    string
+	Content string
+	Path    string
+}
+
+// Fixtures returns the files of the "files" tag, which maps paths relative to
+// the temporary directory to either inline contents or to an object with a
+// "path" (relative to and within the directory of the markdown source) to copy
+// or inline "content"
+func (rn *Runnable) Fixtures() ([]*fixture, error) {
+	rn.parseTags()
+
+	v, ok := rn.Tags["files"]
+	if !ok {
+		return nil, nil
+	}
+
+	mv, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("files tag must be an object, not %T", v)
+	}
+
+	fixtures := []*fixture{}
+
+	for name, value := range mv {
+		cleanName, err := localPath(name)
+		if err != nil {
+			return nil, fmt.Errorf("files tag %w", err)
+		}
+
+		fx := &fixture{Name: cleanName}
+
+		switch val := value.(type) {
+		case string:
+			fx.Content = val
+		case map[string]interface{}:
+			if path, ok := val["path"].(string); ok && path != "" {
+				fx.Path, err = rn.sourceLocalPath(path)
+				if err != nil {
+					return nil, fmt.Errorf("files tag entry %q %w", name, err)
+				}
+			} else if content, ok := val["content"].(string); ok {
+				fx.Content = content
+			} else {
+				return nil, fmt.Errorf("files tag entry %q must have a \"path\" or \"content\"", name)
+			}
+		default:
+			return nil, fmt.Errorf("files tag entry %q must be a string or object, not %T", name, value)
+		}
+
+		fixtures = append(fixtures, fx)
+	}
+
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].Name < fixtures[j].Name })
+
+	return fixtures, nil
+}
+
+func (rn *Runnable) writeFixtures(dir string) error {
+	fixtures, err := rn.Fixtures()
+	if err != nil {
+		return err
+	}
+
+	for _, fx := range fixtures {
+		dest := filepath.Join(dir, fx.Name)
+
+		if fx.Path == "" {
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(dest, []byte(fx.Content), os.FileMode(0644)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := copyPath(fx.Path, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localPath cleans the slash-separated name, which must be relative to and
+// stay within the temporary directory of an example
+func localPath(name string) (string, error) {
+	cleanName := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleanName) || cleanName == "." || cleanName == ".." ||
+		strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q must be relative to the example directory", name)
+	}
+
+	return cleanName, nil
+}
+
+// sourceLocalPath returns the slash-separated path relative to the markdown
+// source, which must stay within the repository of the source
+func (rn *Runnable) sourceLocalPath(path string) (string, error) {
+	fullPath, err := filepath.Abs(rn.sourceRelativePath(path))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(sourceRootDir(rn.SourceFile), fullPath)
+	if err != nil || filepath.IsAbs(filepath.FromSlash(path)) || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q must be within the repository of the markdown source", path)
+	}
+
+	return fullPath, nil
+}
+
+// sourceRootDir returns the root of the repository enclosing the markdown
+// source, which is the nearest directory with a .git, else the directory of
+// the enclosing go.mod, else the directory of the source itself
+func sourceRootDir(sourceFile string) string {
+	sourceDir, err := filepath.Abs(filepath.Dir(sourceFile))
+	if err != nil {
+		return filepath.Dir(sourceFile)
+	}
+
+	for dir := sourceDir; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	if moduleDir := findGoModuleDir(sourceFile); moduleDir != "" {
+		return moduleDir
+	}
+
+	return sourceDir
+}
+
+// copyPath copies the file or directory tree at src to dest
+func copyPath(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dest string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -2,6 +2,7 @@ package gfmrun
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -9,21 +10,31 @@ import (
 
 var (
 	DefaultFrobs = map[string]Frob{
-		"bash":       NewSimpleInterpretedFrob("bash", "bash"),
-		"go":         &GoFrob{},
-		"java":       &JavaFrob{},
-		"javascript": NewSimpleInterpretedFrob("js", "node"),
-		"json":       NewSimpleInterpretedFrob("json", "node"),
-		"python":     NewSimpleInterpretedFrob("py", "python"),
-		"ruby":       NewSimpleInterpretedFrob("rb", "ruby"),
-		"shell":      NewSimpleInterpretedFrob("bash", "bash"),
-		"sh":         NewSimpleInterpretedFrob("sh", "sh"),
-		"zsh":        NewSimpleInterpretedFrob("zsh", "zsh"),
+		"bash":          NewSimpleInterpretedFrob("bash", "bash"),
+		"console":       shellSessionFrob,
+		"go":            &GoFrob{},
+		"java":          &JavaFrob{},
+		"javascript":    NewSimpleInterpretedFrob("js", "node"),
+		"json":          NewSimpleInterpretedFrob("json", "node"),
+		"python":        NewSimpleInterpretedFrob("py", "python"),
+		"ruby":          NewSimpleInterpretedFrob("rb", "ruby"),
+		"shell":         NewSimpleInterpretedFrob("bash", "bash"),
+		"shell-session": shellSessionFrob,
+		"shellsession":  shellSessionFrob,
+		"sh":            NewSimpleInterpretedFrob("sh", "sh"),
+		"zsh":           NewSimpleInterpretedFrob("zsh", "zsh"),
 	}
 
+	shellSessionFrob = &ShellSessionFrob{}
+
 	errEmptySource = fmt.Errorf("empty source")
 
 	javaPublicClassRe = regexp.MustCompile("public +class +([^ ]+)")
+	javaMainMethodRe  = regexp.MustCompile(`static +void +main *\(`)
+
+	shellSessionPromptRe  = regexp.MustCompile(`^\s*\$(?: (.*))?$`)
+	shellSessionMarkerRe  = regexp.MustCompile(`\n::gfmrun-session-(?:command-\d+|end)::\n`)
+	shellSessionHeredocRe = regexp.MustCompile(`(?:^|[^<])<<-?\s*['"]?([A-Za-z_][A-Za-z0-9_]*)['"]?`)
 )
 
 type Frob interface {
@@ -34,9 +45,28 @@ type Frob interface {
 	Commands(*Runnable) []*command
 }
 
+// SourceTransformer is implemented by frobs that write something other than the
+// example source as written to the temporary file that is run
+type SourceTransformer interface {
+	TransformSource(*Runnable) (string, error)
+}
+
+// OutputChecker is implemented by frobs that verify the output of the Main
+// command themselves, in addition to any tags
+type OutputChecker interface {
+	CheckOutput(rn *Runnable, stdout, stderr string) error
+}
+
+// outputCleaner is implemented by frobs that print markers of their own,
+// which are removed from the output once it has been checked
+type outputCleaner interface {
+	cleanOutput(stdout string) string
+}
+
 type command struct {
 	Main bool
 	Args []string
+	Dir  string
 }
 
 func NewSimpleInterpretedFrob(ext, interpreter string) Frob {
@@ -96,40 +126,136 @@ func (e *GoFrob) CanExecute(rn *Runnable) error {
 		return errEmptySource
 	}
 
-	trimmedLine0 := strings.TrimSpace(rn.Lines[0])
+	trimmedLine0 := strings.TrimSpace(rn.SourceLines()[0])
 
-	if trimmedLine0 != "package main" {
+	if trimmedLine0 != "package main" && !rn.Wrap() {
 		return fmt.Errorf("first line is not \"package main\": %q", trimmedLine0)
 	}
 
 	return nil
 }
 
+// TransformSource wraps snippets without a package clause when the example is
+// wrapped, and otherwise leaves the source as it is
+func (e *GoFrob) TransformSource(rn *Runnable) (string, error) {
+	lines := rn.SourceLines()
+
+	if strings.TrimSpace(lines[0]) == "package main" || !rn.Wrap() || goPackageClause(lines) != "" {
+		return rn.String(), nil
+	}
+
+	return wrapGoSnippet(rn.String(), rn.SourceFile), nil
+}
+
 func (e *GoFrob) Environ(_ *Runnable) []string {
 	return []string{}
 }
 
-func (e *GoFrob) Commands(_ *Runnable) []*command {
+func (e *GoFrob) Commands(rn *Runnable) []*command {
 	goExe := ""
 	if runtime.GOOS == "windows" {
 		goExe = ".exe"
 	}
 
-	return []*command{
+	// grouped examples are built as the whole package of their files
+	buildTarget := "{{.FILE}}"
+	if len(rn.GroupFiles) > 0 {
+		buildTarget = "."
+	}
+
+	buildFlags := rn.GoBuildFlags()
+
+	// examples in a shared module are built from their directory within it,
+	// as its dependencies have already been resolved
+	if exampleDir := rn.goWorkspace.exampleDir(rn); exampleDir != "" {
+		pkg := "./" + exampleDir
+
+		if goPkg := goPackageClause(rn.SourceLines()); goPkg != "" && goPkg != "main" {
+			return []*command{
+				{
+					Main: true,
+					Args: append(append([]string{"go", "vet"}, buildFlags...), pkg),
+					Dir:  rn.goWorkspace.Dir,
+				},
+			}
+		}
+
+		buildArgs := append([]string{"go", "build"}, buildFlags...)
+		buildArgs = append(buildArgs, "-o", "{{.NAMEBASE}}"+goExe, pkg)
+
+		if e.crossCompiled(rn) {
+			return []*command{{Main: true, Args: buildArgs, Dir: rn.goWorkspace.Dir}}
+		}
+
+		return []*command{
+			{
+				Args: buildArgs,
+				Dir:  rn.goWorkspace.Dir,
+			},
+			{
+				Main: true,
+				Args: []string{"{{.NAMEBASE}}" + goExe},
+			},
+		}
+	}
+
+	commands := []*command{
 		{
 			Args: []string{"go", "mod", "init", "gfmrun/example{{.LINENO}}"},
 		},
-		{
-			Args: []string{"go", "mod", "tidy"},
-		},
-		{
-			Args: []string{"go", "build", "-o", "{{.NAMEBASE}}" + goExe, "{{.FILE}}"},
+	}
+
+	for _, replacement := range goReplacements(rn.SourceFile, rn.goReplace) {
+		commands = append(commands, &command{
+			Args: []string{"go", "mod", "edit", "-replace=" + replacement},
+		})
+	}
+
+	commands = append(commands, &command{
+		Args: []string{"go", "mod", "tidy"},
+	})
+
+	// packages other than main are only type checked
+	if pkg := goPackageClause(rn.SourceLines()); pkg != "" && pkg != "main" {
+		return append(commands, &command{
+			Main: true,
+			Args: append(append([]string{"go", "vet"}, buildFlags...), "."),
+		})
+	}
+
+	buildArgs := append([]string{"go", "build"}, buildFlags...)
+	buildArgs = append(buildArgs, "-o", "{{.NAMEBASE}}"+goExe, buildTarget)
+
+	// examples built for another platform can only be built
+	if e.crossCompiled(rn) {
+		return append(commands, &command{
+			Main: true,
+			Args: buildArgs,
+		})
+	}
+
+	return append(commands,
+		&command{
+			Args: buildArgs,
 		},
-		{
+		&command{
 			Main: true,
 			Args: []string{"{{.NAMEBASE}}" + goExe},
-		},
+		})
+}
+
+// crossCompiled is true when the "env" tag sets GOOS or GOARCH to something
+// other than the current platform
+func (e *GoFrob) crossCompiled(rn *Runnable) bool {
+	for _, pair := range rn.Env() {
+		key, value, _ := strings.Cut(pair, "=")
+
+		if (key == "GOOS" && value != runtime.GOOS) || (key == "GOARCH" && value != runtime.GOARCH) {
+			return true
+		}
 	}
+
+	return false
 }
 
 type JavaFrob struct{}
@@ -143,7 +269,7 @@ func (e *JavaFrob) CanExecute(rn *Runnable) error {
 		return errEmptySource
 	}
 
-	for _, line := range rn.Lines {
+	for _, line := range rn.SourceLines() {
 		if javaPublicClassRe.MatchString(line) {
 			return nil
 		}
@@ -161,13 +287,37 @@ func (e *JavaFrob) Environ(_ *Runnable) []string {
 }
 
 func (e *JavaFrob) Commands(rn *Runnable) []*command {
+	javacArgs := []string{"javac", "{{.BASENAME}}"}
+	mainSource := rn.String()
+
+	// grouped examples are compiled together and run from the class with a
+	// main method
+	for _, part := range rn.GroupFiles {
+		part.Frob = e
+
+		if name, err := part.FileName(); err == nil {
+			javacArgs = append(javacArgs, filepath.ToSlash(name))
+		}
+
+		if !javaMainMethodRe.MatchString(mainSource) && javaMainMethodRe.MatchString(part.String()) {
+			mainSource = part.String()
+		}
+	}
+
+	// examples of a session are run from the session directory rather than
+	// the directory they were compiled in
+	javaArgs := []string{"java", e.getClassName(mainSource)}
+	if rn.SessionName() != "" {
+		javaArgs = []string{"java", "-cp", "{{.DIR}}", e.getClassName(mainSource)}
+	}
+
 	return []*command{
 		&command{
-			Args: []string{"javac", "{{.BASENAME}}"},
+			Args: javacArgs,
 		},
 		&command{
 			Main: true,
-			Args: []string{"java", e.getClassName(rn.String())},
+			Args: javaArgs,
 		},
 	}
 }
@@ -179,3 +329,188 @@ func (e *JavaFrob) getClassName(source string) string {
 
 	return "Unknown"
 }
+
+// ShellSessionFrob runs console transcripts such as:
+//
+//	$ echo hello
+//	hello
+//
+// where each line starting with a "$ " prompt is a command and the following
+// lines up to the next prompt are its expected output, except for "> "
+// continuation lines of commands ending in "\" or of here-documents.  All
+// commands are run in order by the same bash process with stderr merged into
+// stdout.  Transcripts are only run when enabled via the "shell_session" tag
+// or the Runner.
+type ShellSessionFrob struct{}
+
+type shellSessionCommand struct {
+	Line     int
+	Command  string
+	Expected []string
+}
+
+func (e *ShellSessionFrob) Extension() string {
+	return "bash"
+}
+
+func (e *ShellSessionFrob) CanExecute(rn *Runnable) error {
+	if len(rn.Lines) < 1 {
+		return errEmptySource
+	}
+
+	if !rn.ShellSession() {
+		return fmt.Errorf("shell sessions are not enabled")
+	}
+
+	if len(e.parse(rn)) == 0 {
+		return fmt.Errorf("no \"$ \" prompt lines found")
+	}
+
+	return nil
+}
+
+func (e *ShellSessionFrob) TempFileName(rn *Runnable) string {
+	return fmt.Sprintf("example-L%d-session.bash", rn.LineOffset)
+}
+
+func (e *ShellSessionFrob) Environ(_ *Runnable) []string {
+	return []string{}
+}
+
+func (e *ShellSessionFrob) Commands(_ *Runnable) []*command {
+	return []*command{
+		{
+			Main: true,
+			Args: []string{"bash", "--", "{{.FILE}}"},
+		},
+	}
+}
+
+func (e *ShellSessionFrob) TransformSource(rn *Runnable) (string, error) {
+	// hidden lines are run as setup and teardown outside of the markers so
+	// that their output is not compared
+	before, after := rn.hiddenSplit()
+
+	script := []string{"exec 2>&1"}
+	script = append(script, before...)
+
+	for i, c := range e.parse(rn) {
+		script = append(script,
+			fmt.Sprintf("printf '\\n%%s\\n' '%s'", e.marker(i)),
+			c.Command)
+	}
+
+	script = append(script, fmt.Sprintf("printf '\\n%%s\\n' '%s'", e.marker(-1)))
+	script = append(script, after...)
+	script = append(script, "exit 0")
+
+	return strings.Join(script, "\n") + "\n", nil
+}
+
+func (e *ShellSessionFrob) CheckOutput(rn *Runnable, stdout, _ string) error {
+	errs := multiError{}
+
+	for i, c := range e.parse(rn) {
+		startMarker := "\n" + e.marker(i) + "\n"
+
+		start := strings.Index(stdout, startMarker)
+		if start < 0 {
+			errs = append(errs, fmt.Errorf("%s:%d: command did not run: %s", rn.SourceFile, c.Line, c.Command))
+			continue
+		}
+
+		actual := stdout[start+len(startMarker):]
+		if end := strings.Index(actual, "\n"+e.marker(i+1)+"\n"); end >= 0 {
+			actual = actual[:end]
+		} else if end := strings.Index(actual, "\n"+e.marker(-1)+"\n"); end >= 0 {
+			actual = actual[:end]
+		}
+
+		expected := normalizeOutput(strings.Join(c.Expected, "\n"))
+		actual = normalizeOutput(actual)
+
+		if expected != actual {
+			errs = append(errs, &OutputMismatchError{
+				Stream:   "stdout",
+				Expected: expected,
+				Actual:   actual,
+				Diff:     unifiedDiff(expected, actual),
+				Source:   fmt.Sprintf("%s:%d (%s)", rn.SourceFile, c.Line, c.Command),
+			})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// cleanOutput removes the markers between the output of the commands, along
+// with the newline printed before each of them
+func (e *ShellSessionFrob) cleanOutput(stdout string) string {
+	return shellSessionMarkerRe.ReplaceAllString(stdout, "")
+}
+
+func (e *ShellSessionFrob) marker(i int) string {
+	if i < 0 {
+		return "::gfmrun-session-end::"
+	}
+
+	return fmt.Sprintf("::gfmrun-session-command-%d::", i)
+}
+
+func (e *ShellSessionFrob) parse(rn *Runnable) []*shellSessionCommand {
+	commands := []*shellSessionCommand{}
+	var cur *shellSessionCommand
+	continued := false
+	heredocs := []string{}
+
+	for i, line := range rn.Lines {
+		if continued {
+			line = strings.TrimRight(strings.TrimLeft(line, " \t"), " \t\r")
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+			cur.Command += "\n" + line
+			heredocs = shellSessionHeredocs(heredocs, line)
+			continued = strings.HasSuffix(line, "\\") || len(heredocs) > 0
+			continue
+		}
+
+		if m := shellSessionPromptRe.FindStringSubmatch(line); m != nil {
+			cur = &shellSessionCommand{
+				Line:     rn.LineOffset + 1 + i,
+				Command:  m[1],
+				Expected: []string{},
+			}
+			commands = append(commands, cur)
+			heredocs = shellSessionHeredocs(nil, m[1])
+			continued = strings.HasSuffix(m[1], "\\") || len(heredocs) > 0
+			continue
+		}
+
+		if cur != nil {
+			cur.Expected = append(cur.Expected, line)
+		}
+	}
+
+	return commands
+}
+
+// shellSessionHeredocs returns the delimiters of the here-documents that are
+// still open after a line of a command, given those open before it
+func shellSessionHeredocs(open []string, line string) []string {
+	if len(open) > 0 {
+		if strings.TrimSpace(line) == open[0] {
+			return open[1:]
+		}
+
+		return open
+	}
+
+	for _, m := range shellSessionHeredocRe.FindAllStringSubmatch(line, -1) {
+		open = append(open, m[1])
+	}
+
+	return open
+}
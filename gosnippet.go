@@ -0,0 +1,424 @@
+package gfmrun
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	goStdPackagesOnce sync.Once
+	goStdPackages     map[string][]string
+
+	goModulePackagesLock sync.Mutex
+	goModulePackages     = map[string]map[string][]string{}
+
+	// goPreferredImports breaks ties between packages of the same name when
+	// inferring imports, favoring the more commonly used package
+	goPreferredImports = map[string]string{
+		"rand":     "math/rand",
+		"template": "text/template",
+	}
+)
+
+// goPackageClause returns the package name of the first line of the source
+// that is not blank or a comment, or "" when it is not a package clause
+func goPackageClause(lines []string) string {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+
+		if fields := strings.Fields(trimmed); len(fields) > 1 && fields[0] == "package" {
+			return fields[1]
+		}
+
+		return ""
+	}
+
+	return ""
+}
+
+// wrapGoSnippet makes a main package of a snippet without a package clause,
+// either by adding an empty main func to top-level declarations or by placing
+// statements in the body of the main func, and adds imports of the packages
+// it refers to
+func wrapGoSnippet(snippet, sourceFile string) string {
+	source := "package main\n\n" + snippet + "\n"
+
+	if file, err := parser.ParseFile(token.NewFileSet(), "", source, 0); err == nil {
+		if file.Scope.Lookup("main") == nil {
+			source += "\nfunc main() {}\n"
+		}
+	} else {
+		source = "package main\n\nfunc main() {\n" + snippet + "\n}\n"
+	}
+
+	imports := inferGoImports(source, sourceFile)
+	if len(imports) == 0 {
+		return source
+	}
+
+	importLines := []string{}
+	for _, importPath := range imports {
+		importLines = append(importLines, fmt.Sprintf("import %q", importPath))
+	}
+
+	return "package main\n\n" + strings.Join(importLines, "\n") + "\n" +
+		strings.TrimPrefix(source, "package main\n")
+}
+
+// inferGoImports returns the import paths of the packages that the source
+// refers to without importing, chosen from the standard library and then the
+// packages of the module enclosing the markdown source
+func inferGoImports(source, sourceFile string) []string {
+	// a partial syntax tree is still useful for finding references
+	file, _ := parser.ParseFile(token.NewFileSet(), "", source, parser.AllErrors)
+	if file == nil {
+		return nil
+	}
+
+	imported := map[string]bool{}
+	for _, spec := range file.Imports {
+		name := path.Base(strings.Trim(spec.Path.Value, `"`))
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imported[name] = true
+	}
+
+	unresolved := map[string]bool{}
+	for _, ident := range file.Unresolved {
+		unresolved[ident.Name] = true
+	}
+
+	names := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && unresolved[ident.Name] && !imported[ident.Name] {
+				names[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	goStdPackagesOnce.Do(func() {
+		goStdPackages = listGoPackages("", "std")
+	})
+
+	// packages of the standard library come first, so that they are preferred
+	// over packages of the module with the same name, such as its own "log"
+	candidates := map[string][]string{}
+	for name, paths := range goStdPackages {
+		candidates[name] = append(candidates[name], paths...)
+	}
+
+	for name, paths := range loadGoModulePackages(sourceFile) {
+		candidates[name] = append(candidates[name], paths...)
+	}
+
+	imports := []string{}
+	for name := range names {
+		paths := candidates[name]
+		if len(paths) == 0 {
+			continue
+		}
+
+		importPath := paths[0]
+		for _, p := range paths {
+			if p == goPreferredImports[name] {
+				importPath = p
+			}
+		}
+
+		imports = append(imports, importPath)
+	}
+
+	sort.Strings(imports)
+	return imports
+}
+
+// loadGoModulePackages returns the packages of the module enclosing the
+// markdown source by name, if any
+func loadGoModulePackages(sourceFile string) map[string][]string {
+	moduleDir := findGoModuleDir(sourceFile)
+	if moduleDir == "" {
+		return nil
+	}
+
+	goModulePackagesLock.Lock()
+	defer goModulePackagesLock.Unlock()
+
+	if pkgs, ok := goModulePackages[moduleDir]; ok {
+		return pkgs
+	}
+
+	pkgs := listGoPackages(moduleDir, "./...")
+	goModulePackages[moduleDir] = pkgs
+	return pkgs
+}
+
+// findGoModuleDir returns the directory of the go.mod enclosing the markdown
+// source, or "" when there is none
+func findGoModuleDir(sourceFile string) string {
+	dir, err := filepath.Abs(filepath.Dir(sourceFile))
+	if err != nil {
+		return ""
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readGoModulePath returns the module path declared by the go.mod in dir, or
+// "" when it cannot be read
+func readGoModulePath(dir string) string {
+	goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(goMod), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+
+	return ""
+}
+
+// findGoWorkModuleDirs returns the directories of the "use" directives of the
+// go.work enclosing the markdown source, or nil when there is none
+func findGoWorkModuleDirs(sourceFile string) []string {
+	dir, err := filepath.Abs(filepath.Dir(sourceFile))
+	if err != nil {
+		return nil
+	}
+
+	for {
+		if goWork, err := os.ReadFile(filepath.Join(dir, "go.work")); err == nil {
+			return readGoWorkUses(dir, string(goWork))
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// readGoWorkUses returns the directories of the "use" directives of a go.work
+// in dir, in both the single line and the block form, made absolute
+func readGoWorkUses(dir, goWork string) []string {
+	dirs := []string{}
+	inBlock := false
+
+	for _, line := range strings.Split(goWork, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		usePath := ""
+
+		switch {
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock:
+			usePath = fields[0]
+		case fields[0] == "use" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == "use" && len(fields) == 2:
+			usePath = fields[1]
+		}
+
+		if usePath = strings.Trim(usePath, "\"`"); usePath == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(usePath) {
+			usePath = filepath.Join(dir, filepath.FromSlash(usePath))
+		}
+
+		dirs = append(dirs, filepath.Clean(usePath))
+	}
+
+	return dirs
+}
+
+// goReplacements returns the "module=path" replace directives of the go.mod
+// of a Go example, which are the module enclosing the markdown source and the
+// modules of the go.work enclosing it followed by the given replacements, with
+// paths made absolute
+func goReplacements(sourceFile string, replace []string) []string {
+	replacements := []string{}
+	moduleDirs := findGoWorkModuleDirs(sourceFile)
+	seen := map[string]bool{}
+
+	if moduleDir := findGoModuleDir(sourceFile); moduleDir != "" {
+		moduleDirs = append([]string{moduleDir}, moduleDirs...)
+	}
+
+	for _, moduleDir := range moduleDirs {
+		if modulePath := readGoModulePath(moduleDir); modulePath != "" && !seen[modulePath] {
+			seen[modulePath] = true
+			replacements = append(replacements, modulePath+"="+moduleDir)
+		}
+	}
+
+	for _, r := range replace {
+		modulePath, replacePath, ok := strings.Cut(r, "=")
+		if !ok {
+			continue
+		}
+
+		// local paths must be absolute, as the go.mod is in a temporary
+		// directory, while module versions such as "mod@v1.2.3" are kept, so
+		// relative paths without a leading "./" must be existing directories
+		if isGoReplaceDir(replacePath) {
+			if absPath, err := filepath.Abs(replacePath); err == nil {
+				replacePath = absPath
+			}
+		}
+
+		replacements = append(replacements, modulePath+"="+replacePath)
+	}
+
+	return replacements
+}
+
+// isGoReplaceDir is true when the replacement of a replace directive is a
+// local directory rather than a module version, i.e. it is absolute, starts
+// with "." like in a go.mod, or is the relative path of an existing directory
+func isGoReplaceDir(replacePath string) bool {
+	if filepath.IsAbs(replacePath) || strings.HasPrefix(replacePath, ".") {
+		return true
+	}
+
+	if strings.Contains(replacePath, "@") {
+		return false
+	}
+
+	info, err := os.Stat(replacePath)
+	return err == nil && info.IsDir()
+}
+
+// splitGoFlags splits go tool flags on whitespace like a shell would, so that
+// quoted values such as -ldflags "-X main.version=1.0 -s" are kept together
+func splitGoFlags(s string) ([]string, error) {
+	flags := []string{}
+	flag := strings.Builder{}
+	inFlag := false
+	quote := rune(0)
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			flag.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inFlag = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			flag.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inFlag = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inFlag {
+				flags = append(flags, flag.String())
+				flag.Reset()
+				inFlag = false
+			}
+		default:
+			flag.WriteRune(r)
+			inFlag = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in go flags %q", s)
+	}
+
+	if inFlag {
+		flags = append(flags, flag.String())
+	}
+
+	return flags, nil
+}
+
+// listGoPackages returns the non-internal import paths matching the pattern
+// by package name, shortest paths first
+func listGoPackages(dir, pattern string) map[string][]string {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.Name}} {{.ImportPath}}", pattern)
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	pkgs := map[string][]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] == "main" {
+			continue
+		}
+
+		name, importPath := fields[0], fields[1]
+		if strings.Contains("/"+importPath+"/", "/internal/") || strings.HasPrefix(importPath, "vendor/") {
+			continue
+		}
+
+		pkgs[name] = append(pkgs[name], importPath)
+	}
+
+	for _, paths := range pkgs {
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+
+	return pkgs
+}
@@ -0,0 +1,69 @@
+package gfmrun
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitGoFlags(t *testing.T) {
+	for _, tc := range []struct {
+		flags    string
+		expected []string
+	}{
+		{"", []string{}},
+		{"-race -tags=integration", []string{"-race", "-tags=integration"}},
+		{`-ldflags "-X main.version=1.0 -s" -trimpath`, []string{"-ldflags", "-X main.version=1.0 -s", "-trimpath"}},
+		{`-ldflags='-X a=b'`, []string{"-ldflags=-X a=b"}},
+		{`-tags ''  -v`, []string{"-tags", "", "-v"}},
+		{`-o a\ b`, []string{"-o", "a b"}},
+	} {
+		flags, err := splitGoFlags(tc.flags)
+		assert.Nil(t, err, tc.flags)
+		assert.Equal(t, tc.expected, flags, tc.flags)
+	}
+
+	_, err := splitGoFlags(`-ldflags "-s`)
+	assert.NotNil(t, err)
+}
+
+func TestGoReplacements(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "sub", "mod"), 0755))
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	defer func() { _ = os.Chdir(wd) }()
+
+	assert.Equal(t, []string{
+		"example.com/sub=" + filepath.Join(dir, "sub", "mod"),
+		"example.com/dot=" + filepath.Join(dir, "sub"),
+		"example.com/mod=example.com/fork@v1.2.3",
+		"example.com/missing=missing/mod",
+	}, goReplacements(filepath.Join(dir, "EXAMPLES.md"), []string{
+		"example.com/sub=sub/mod",
+		"example.com/dot=./sub",
+		"example.com/mod=example.com/fork@v1.2.3",
+		"example.com/missing=missing/mod",
+	}))
+}
+
+func TestInferGoImports(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, pkg := range []string{"log", "greet"} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, pkg), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, pkg, pkg+".go"), []byte("package "+pkg+"\n\nfunc Hello() {}\n"), 0600))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.18\n"), 0600))
+
+	assert.Equal(t, []string{"example.com/app/greet", "log"}, inferGoImports(strings.Join([]string{
+		"package main",
+		"",
+		`func main() { log.Println(greet.Hello) }`,
+	}, "\n"), filepath.Join(dir, "EXAMPLES.md")))
+}
@@ -0,0 +1,196 @@
+package gfmrun
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// goWorkspace is a single module shared by the Go examples of a source, with
+// each example in a directory of its own, so that dependencies are resolved
+// once rather than once per example
+type goWorkspace struct {
+	Dir string
+
+	// TidyTime is how long resolving the dependencies of all of the examples
+	// took, which is roughly the time saved per example sharing the module
+	TidyTime time.Duration
+
+	examples map[*Runnable]string
+}
+
+// exampleDir returns the directory of the example relative to the workspace,
+// or "" when the example is not part of the workspace
+func (ws *goWorkspace) exampleDir(rn *Runnable) string {
+	if ws == nil {
+		return ""
+	}
+
+	return ws.examples[rn]
+}
+
+// TimeSaved estimates the time saved by not resolving the dependencies of
+// each example in a module of its own
+func (ws *goWorkspace) TimeSaved() time.Duration {
+	if ws == nil || len(ws.examples) < 2 {
+		return 0
+	}
+
+	return ws.TidyTime * time.Duration(len(ws.examples)-1)
+}
+
+// Remove removes the workspace directory unless temporary files are preserved
+func (ws *goWorkspace) Remove() {
+	if ws == nil || os.Getenv("GFMRUN_PRESERVE_TMPFILES") == "1" {
+		return
+	}
+
+	_ = os.RemoveAll(ws.Dir)
+}
+
+// goIsolated is true when the example must be built as a module of its own,
+// because of a "go_isolate" tag, because it brings its own go.mod, or because
+// its "files" or "env" tags would not apply to the shared module
+func goIsolated(rn *Runnable) bool {
+	rn.parseTags()
+
+	if isolate, _ := rn.Tags["go_isolate"].(bool); isolate {
+		return true
+	}
+
+	if _, ok := rn.Tags["files"]; ok {
+		return true
+	}
+
+	if _, ok := rn.Tags["env"]; ok {
+		return true
+	}
+
+	for _, part := range rn.GroupFiles {
+		part.Frob = rn.Frob
+		if name, err := part.FileName(); err == nil && filepath.Base(name) == "go.mod" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newGoWorkspace writes the Go examples among the runnables to a shared
+// module and resolves its dependencies, returning nil when there are fewer
+// than two such examples or the module cannot be prepared, in which case each
+// example is built as a module of its own
+func newGoWorkspace(ctx context.Context, sourceName string, runnables []*Runnable, replace []string, env []string, log *logrus.Logger) *goWorkspace {
+	examples := []*Runnable{}
+	for _, rn := range runnables {
+		if _, ok := rn.Frob.(*GoFrob); ok && !goIsolated(rn) {
+			examples = append(examples, rn)
+		}
+	}
+
+	if len(examples) < 2 {
+		return nil
+	}
+
+	baseTmp := filepath.Join(os.TempDir(), "gfmrun")
+	if err := os.MkdirAll(baseTmp, 0755); err != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp(baseTmp, "go.*")
+	if err != nil {
+		return nil
+	}
+
+	ws := &goWorkspace{Dir: dir, examples: map[*Runnable]string{}}
+
+	if err := ws.prepare(ctx, sourceName, examples, replace, env); err != nil {
+		log.WithFields(logrus.Fields{
+			"source":   sourceName,
+			"examples": len(examples),
+			"err":      err,
+		}).Warn("failed to prepare shared go module, building examples separately")
+
+		ws.Remove()
+		return nil
+	}
+
+	log.WithFields(logrus.Fields{
+		"source":   sourceName,
+		"examples": len(ws.examples),
+		"time":     ws.TidyTime,
+	}).Debug("prepared shared go module")
+
+	return ws
+}
+
+func (ws *goWorkspace) prepare(ctx context.Context, sourceName string, examples []*Runnable, replace []string, env []string) error {
+	if err := ws.goCommand(ctx, env, "mod", "init", "gfmrun/examples"); err != nil {
+		return err
+	}
+
+	for _, replacement := range goReplacements(sourceName, replace) {
+		if err := ws.goCommand(ctx, env, "mod", "edit", "-replace="+replacement); err != nil {
+			return err
+		}
+	}
+
+	exampleDirs := map[*Runnable]string{}
+
+	for _, rn := range examples {
+		exampleDir := fmt.Sprintf("example-L%d", rn.LineOffset)
+
+		fileName, err := rn.FileName()
+		if err != nil {
+			return err
+		}
+
+		source, err := rn.transformedSource()
+		if err != nil {
+			return err
+		}
+
+		examplePath := filepath.Join(ws.Dir, exampleDir, fileName)
+		if err := os.MkdirAll(filepath.Dir(examplePath), 0755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(examplePath, []byte(source), os.FileMode(0644)); err != nil {
+			return err
+		}
+
+		if err := rn.writeGroupFiles(filepath.Join(ws.Dir, exampleDir)); err != nil {
+			return err
+		}
+
+		exampleDirs[rn] = exampleDir
+	}
+
+	start := time.Now()
+
+	if err := ws.goCommand(ctx, env, "mod", "tidy"); err != nil {
+		return err
+	}
+
+	ws.TidyTime = time.Since(start)
+	ws.examples = exampleDirs
+	return nil
+}
+
+func (ws *goWorkspace) goCommand(ctx context.Context, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = ws.Dir
+	cmd.Env = env
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go %s: %w: %s", strings.Join(args, " "), err, out)
+	}
+
+	return nil
+}
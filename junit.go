@@ -0,0 +1,129 @@
+package gfmrun
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Error      *junitMessage    `xml:"error,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+	SystemErr  string           `xml:"system-err,omitempty"`
+}
+
+// junitProperties are properties of a testcase, such as whether its result
+// was cached, which are reported apart from its name so that it stays the same
+// across runs
+type junitProperties struct {
+	Properties []*junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// newJUnitTestSuite makes a testsuite for a single source from the results of
+// its examples, which may be empty if the source could not be read
+func newJUnitTestSuite(sourceName string, start time.Time, dur time.Duration, res []*Result, sourceErr error) *junitTestSuite {
+	suite := &junitTestSuite{
+		Name:      sourceName,
+		Time:      junitSeconds(dur),
+		Timestamp: start.UTC().Format("2006-01-02T15:04:05"),
+		TestCases: []*junitTestCase{},
+	}
+
+	if sourceErr != nil {
+		suite.Tests = 1
+		suite.Errors = 1
+		suite.TestCases = append(suite.TestCases, &junitTestCase{
+			Name:      sourceName,
+			ClassName: sourceName,
+			Time:      junitSeconds(0),
+			Error:     &junitMessage{Message: sourceErr.Error()},
+		})
+		return suite
+	}
+
+	for _, result := range res {
+		if result == nil {
+			continue
+		}
+
+		tc := &junitTestCase{
+			Name:      result.Runnable.Name(),
+			ClassName: sourceName,
+			Time:      junitSeconds(result.Duration),
+			SystemOut: result.Stdout,
+			SystemErr: result.Stderr,
+		}
+
+		if result.Cached {
+			tc.Properties = &junitProperties{
+				Properties: []*junitProperty{{Name: "cached", Value: "true"}},
+			}
+		}
+
+		suite.Tests++
+
+		switch v := result.Error.(type) {
+		case nil:
+		case *SkipError:
+			suite.Skipped++
+			tc.Skipped = &junitMessage{Message: v.Reason}
+		case *TimeoutError:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: v.Error(), Type: "timeout"}
+		default:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: v.Error(), Type: "failure", Body: v.Error()}
+		}
+
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	return suite
+}
+
+func writeJUnitReport(path string, suites []*junitTestSuite) error {
+	xmlBytes, err := xml.MarshalIndent(&junitTestSuites{Suites: suites}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), append(xmlBytes, '\n')...), os.FileMode(0644))
+}
+
+func junitSeconds(dur time.Duration) string {
+	return fmt.Sprintf("%.3f", dur.Seconds())
+}
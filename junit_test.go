@@ -0,0 +1,46 @@
+package gfmrun
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJUnitTestSuite(t *testing.T) {
+	rn := NewRunnable("README.md", testLog)
+	rn.LineOffset = 42
+	rn.Lang = "go"
+
+	suite := newJUnitTestSuite("README.md", time.Now(), time.Second, []*Result{
+		{Runnable: rn, Stdout: "ok\n"},
+		{Runnable: rn, Error: &SkipError{Reason: "os not supported"}},
+		{Runnable: rn, Error: &TimeoutError{Timeout: time.Second}},
+		{Runnable: rn, Error: errors.New("exit status 1")},
+		{Runnable: rn, Stdout: "ok\n", Cached: true},
+	}, nil)
+
+	assert.Equal(t, "README.md", suite.Name)
+	assert.Equal(t, 5, suite.Tests)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, "1.000", suite.Time)
+	assert.Equal(t, "README.md:L42-go", suite.TestCases[0].Name)
+	assert.Equal(t, "ok\n", suite.TestCases[0].SystemOut)
+	assert.Equal(t, "os not supported", suite.TestCases[1].Skipped.Message)
+	assert.Equal(t, "timeout", suite.TestCases[2].Failure.Type)
+	assert.Equal(t, "failure", suite.TestCases[3].Failure.Type)
+	assert.Equal(t, "README.md:L42-go", suite.TestCases[4].Name)
+	assert.Equal(t, []*junitProperty{{Name: "cached", Value: "true"}}, suite.TestCases[4].Properties.Properties)
+	assert.Nil(t, suite.TestCases[0].Properties)
+
+	xmlBytes, err := xml.Marshal(suite.TestCases[4])
+	assert.Nil(t, err)
+	assert.Contains(t, string(xmlBytes), `<properties><property name="cached" value="true"></property></properties>`)
+
+	xmlBytes, err = xml.Marshal(suite.TestCases[0])
+	assert.Nil(t, err)
+	assert.NotContains(t, string(xmlBytes), "properties")
+}
@@ -3,6 +3,7 @@ package gfmrun
 import (
 	"io"
 	"os"
+	"testing"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,3 +17,19 @@ func init() {
 	testLog.Level = logrus.PanicLevel
 	testLog.Out = io.Discard
 }
+
+func TestMain(m *testing.M) {
+	// keep anything cached by test examples out of the user's cache
+	cacheHome, err := os.MkdirTemp("", "gfmrun-test-cache")
+	if err == nil {
+		_ = os.Setenv("XDG_CACHE_HOME", cacheHome)
+	}
+
+	code := m.Run()
+
+	if cacheHome != "" {
+		_ = os.RemoveAll(cacheHome)
+	}
+
+	os.Exit(code)
+}
@@ -0,0 +1,315 @@
+package gfmrun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// defaultReadyTimeout is how long an example with a "ready" tag is
+	// waited for when the tag does not give a timeout of its own
+	defaultReadyTimeout = 10 * time.Second
+
+	readyPollInterval = 100 * time.Millisecond
+	probeTimeout      = 5 * time.Second
+)
+
+// readiness is the condition of a "ready" tag that a long-running example
+// must meet before it is probed and stopped
+type readiness struct {
+	Output  *regexp.Regexp
+	TCP     string
+	HTTP    string
+	Timeout time.Duration
+}
+
+func (rd *readiness) String() string {
+	switch {
+	case rd.Output != nil:
+		return fmt.Sprintf("output matching %q", rd.Output.String())
+	case rd.TCP != "":
+		return fmt.Sprintf("tcp %s", rd.TCP)
+	default:
+		return fmt.Sprintf("http %s", rd.HTTP)
+	}
+}
+
+// probe is a request of a "probe" tag that is made against a running example
+type probe struct {
+	Method  string
+	URL     string
+	Data    string
+	Headers map[string]string
+	Status  int
+	Body    *regexp.Regexp
+}
+
+// Readiness returns the condition of the "ready" tag, which is either a regexp
+// that the program output (stdout) must match or an object with one of an
+// "output" regexp, a "tcp" address that must accept connections, or an "http"
+// URL that must respond with a 2xx status, and an optional "timeout"
+func (rn *Runnable) Readiness() (*readiness, error) {
+	rn.parseTags()
+
+	v, ok := rn.Tags["ready"]
+	if !ok {
+		return nil, nil
+	}
+
+	rd := &readiness{Timeout: defaultReadyTimeout}
+
+	switch val := v.(type) {
+	case string:
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return nil, fmt.Errorf("ready tag: %w", err)
+		}
+		rd.Output = re
+	case map[string]interface{}:
+		if s, ok := val["output"].(string); ok {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("ready tag: %w", err)
+			}
+			rd.Output = re
+		}
+
+		rd.TCP, _ = val["tcp"].(string)
+		rd.HTTP, _ = val["http"].(string)
+
+		if s, ok := val["timeout"].(string); ok {
+			dur, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("ready tag: %w", err)
+			}
+			rd.Timeout = dur
+		}
+	default:
+		return nil, fmt.Errorf("ready tag must be a string or object, not %T", v)
+	}
+
+	if rd.Output == nil && rd.TCP == "" && rd.HTTP == "" {
+		return nil, fmt.Errorf("ready tag must have an \"output\", \"tcp\", or \"http\" condition")
+	}
+
+	return rd, nil
+}
+
+// Probes returns the requests of the "probe" tag, which is an object or an
+// array of objects with a "url" and optional "method", "data", "headers",
+// expected "status" (any 2xx by default), and "body" regexp
+func (rn *Runnable) Probes() ([]*probe, error) {
+	rn.parseTags()
+
+	v, ok := rn.Tags["probe"]
+	if !ok {
+		return nil, nil
+	}
+
+	values := []interface{}{v}
+	if iv, ok := v.([]interface{}); ok {
+		values = iv
+	}
+
+	probes := []*probe{}
+
+	for _, value := range values {
+		mv, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("probe tag must be an object or array of objects, not %T", value)
+		}
+
+		pr := &probe{Method: http.MethodGet, Headers: map[string]string{}}
+
+		pr.URL, _ = mv["url"].(string)
+		if pr.URL == "" {
+			return nil, fmt.Errorf("probe tag must have a \"url\"")
+		}
+
+		if s, ok := mv["method"].(string); ok && s != "" {
+			pr.Method = strings.ToUpper(s)
+		}
+
+		pr.Data, _ = mv["data"].(string)
+
+		if headers, ok := mv["headers"].(map[string]interface{}); ok {
+			for key, value := range headers {
+				pr.Headers[key] = fmt.Sprintf("%v", value)
+			}
+		}
+
+		if f, ok := mv["status"].(float64); ok {
+			pr.Status = int(f)
+		}
+
+		if s, ok := mv["body"].(string); ok {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("probe tag: %w", err)
+			}
+			pr.Body = re
+		}
+
+		probes = append(probes, pr)
+	}
+
+	return probes, nil
+}
+
+// await polls until the readiness condition is met, the ready timeout
+// elapses, or the context is done
+func (rd *readiness) await(ctx context.Context, output fmt.Stringer) error {
+	ctx, cancel := context.WithTimeout(ctx, rd.Timeout)
+	defer cancel()
+
+	for {
+		if rd.check(ctx, output) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return &ReadyError{Condition: rd.String(), Timeout: rd.Timeout}
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+func (rd *readiness) check(ctx context.Context, output fmt.Stringer) bool {
+	switch {
+	case rd.Output != nil:
+		return rd.Output.MatchString(output.String())
+	case rd.TCP != "":
+		conn, err := (&net.Dialer{Timeout: readyPollInterval}).DialContext(ctx, "tcp", rd.TCP)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	default:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rd.HTTP, nil)
+		if err != nil {
+			return false
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+
+		return resp.StatusCode >= 200 && resp.StatusCode < 300
+	}
+}
+
+// do makes the probe request and checks the response
+func (pr *probe) do(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if pr.Data != "" {
+		body = strings.NewReader(pr.Data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, pr.Method, pr.URL, body)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range pr.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &ProbeError{Method: pr.Method, URL: pr.URL, Err: err}
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &ProbeError{Method: pr.Method, URL: pr.URL, Err: err}
+	}
+
+	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if pr.Status != 0 {
+		statusOK = resp.StatusCode == pr.Status
+	}
+
+	if !statusOK || (pr.Body != nil && !pr.Body.Match(respBody)) {
+		probeErr := &ProbeError{
+			Method:         pr.Method,
+			URL:            pr.URL,
+			Status:         resp.StatusCode,
+			ExpectedStatus: pr.Status,
+			Body:           string(respBody),
+		}
+
+		if pr.Body != nil {
+			probeErr.ExpectedBody = pr.Body.String()
+		}
+
+		return probeErr
+	}
+
+	return nil
+}
+
+// readyAndProbe waits for the example to be ready and then makes the probe
+// requests against it
+func (rn *Runnable) readyAndProbe(ctx context.Context, output fmt.Stringer) error {
+	rd, err := rn.Readiness()
+	if err != nil {
+		return err
+	}
+
+	probes, err := rn.Probes()
+	if err != nil {
+		return err
+	}
+
+	// without a readiness condition, probes wait for the host and port of
+	// only the first probe URL to accept connections, as the others are
+	// expected to be served by the same program
+	if rd == nil && len(probes) > 0 {
+		if u, err := url.Parse(probes[0].URL); err == nil {
+			port := u.Port()
+			if port == "" {
+				port = map[string]string{"https": "443"}[u.Scheme]
+			}
+			if port == "" {
+				port = "80"
+			}
+
+			rd = &readiness{TCP: net.JoinHostPort(u.Hostname(), port), Timeout: defaultReadyTimeout}
+		}
+	}
+
+	if rd != nil {
+		if err := rd.await(ctx, output); err != nil {
+			return err
+		}
+	}
+
+	errs := multiError{}
+	for _, pr := range probes {
+		if err := pr.do(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package gfmrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunnable_Readiness(t *testing.T) {
+	rd, err := newTaggedRunnable(`{}`).Readiness()
+	assert.Nil(t, err)
+	assert.Nil(t, rd)
+
+	rd, err = newTaggedRunnable(`{ "ready": "listening on \\d+" }`).Readiness()
+	assert.Nil(t, err)
+	assert.Equal(t, `listening on \d+`, rd.Output.String())
+	assert.Equal(t, defaultReadyTimeout, rd.Timeout)
+
+	rd, err = newTaggedRunnable(`{ "ready": { "tcp": "localhost:8080", "timeout": "3s" } }`).Readiness()
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:8080", rd.TCP)
+	assert.Equal(t, 3*time.Second, rd.Timeout)
+	assert.Equal(t, "tcp localhost:8080", rd.String())
+
+	for _, rawTags := range []string{
+		`{ "ready": "(" }`,
+		`{ "ready": 8080 }`,
+		`{ "ready": { "timeout": "3s" } }`,
+		`{ "ready": { "http": "http://localhost", "timeout": "soon" } }`,
+	} {
+		_, err := newTaggedRunnable(rawTags).Readiness()
+		assert.NotNil(t, err, rawTags)
+	}
+}
+
+func TestRunnable_Probes(t *testing.T) {
+	probes, err := newTaggedRunnable(`{ "probe": { "url": "http://localhost/ok", "method": "post", "headers": { "X-Count": 3 }, "status": 201 } }`).Probes()
+	assert.Nil(t, err)
+	assert.Len(t, probes, 1)
+	assert.Equal(t, http.MethodPost, probes[0].Method)
+	assert.Equal(t, map[string]string{"X-Count": "3"}, probes[0].Headers)
+	assert.Equal(t, 201, probes[0].Status)
+
+	probes, err = newTaggedRunnable(`{ "probe": [{ "url": "http://localhost/one" }, { "url": "http://localhost/two", "body": "^two$" }] }`).Probes()
+	assert.Nil(t, err)
+	assert.Len(t, probes, 2)
+	assert.Equal(t, http.MethodGet, probes[1].Method)
+	assert.Equal(t, "^two$", probes[1].Body.String())
+
+	for _, rawTags := range []string{
+		`{ "probe": "http://localhost" }`,
+		`{ "probe": { "method": "GET" } }`,
+		`{ "probe": { "url": "http://localhost", "body": "(" } }`,
+	} {
+		_, err := newTaggedRunnable(rawTags).Probes()
+		assert.NotNil(t, err, rawTags)
+	}
+}
+
+func TestProbe_Do(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Name"), body)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	pr := &probe{
+		Method:  http.MethodPut,
+		URL:     server.URL + "/ok",
+		Data:    "data",
+		Headers: map[string]string{"X-Name": "gopher"},
+	}
+	pr.Body = regexp.MustCompile("^PUT /ok gopher data$")
+	assert.Nil(t, pr.do(ctx))
+
+	probeErr := &ProbeError{}
+
+	pr = &probe{Method: http.MethodGet, URL: server.URL + "/created", Status: 201}
+	assert.True(t, errors.As(pr.do(ctx), &probeErr))
+	assert.Equal(t, 200, probeErr.Status)
+	assert.Equal(t, 201, probeErr.ExpectedStatus)
+
+	pr = &probe{Method: http.MethodGet, URL: server.URL + "/ok", Body: regexp.MustCompile("nope")}
+	assert.True(t, errors.As(pr.do(ctx), &probeErr))
+	assert.Equal(t, "GET /ok  ", probeErr.Body)
+	assert.Equal(t, "nope", probeErr.ExpectedBody)
+}
+
+func TestReadiness_Await(t *testing.T) {
+	output := &syncBuffer{}
+	rd := &readiness{Output: regexp.MustCompile("listening"), Timeout: 300 * time.Millisecond}
+
+	readyErr := &ReadyError{}
+	assert.True(t, errors.As(rd.await(context.Background(), output), &readyErr))
+	assert.False(t, readyErr.Exited)
+
+	_, _ = output.Write([]byte("listening\n"))
+	assert.Nil(t, rd.await(context.Background(), output))
+}
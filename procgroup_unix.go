@@ -0,0 +1,108 @@
+//go:build !windows
+
+package gfmrun
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// interruptSignals are the signals that may be given by name in the
+// "signals" of an "interrupt" tag
+var interruptSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// setProcessGroup makes the command the leader of a new process group, so
+// that it and all of its descendants may be signaled together
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends the signal to every process in the process group
+// of the started command
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	err := syscall.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+
+	return err
+}
+
+// processGroupMembers returns the pids of the processes that are still
+// running in the process group, not counting zombies that have yet to be
+// reaped
+func processGroupMembers(pgid int) []int {
+	statFiles, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil || len(statFiles) == 0 {
+		return psProcessGroupMembers(pgid)
+	}
+
+	pids := []int{}
+
+	for _, statFile := range statFiles {
+		statBytes, err := os.ReadFile(statFile)
+		if err != nil {
+			continue
+		}
+
+		// the command name in parentheses may contain spaces, so the fields
+		// of interest are counted from after it: state, ppid, and pgrp
+		stat := string(statBytes)
+		fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+		if len(fields) < 3 || fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+
+		if pgrp, err := strconv.Atoi(fields[2]); err != nil || pgrp != pgid {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(filepath.Base(filepath.Dir(statFile))); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// psProcessGroupMembers returns the pids of the processes that are still
+// running in the process group according to ps, for systems without /proc,
+// or none when ps is unavailable so that no leaks are reported
+func psProcessGroupMembers(pgid int) []int {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,pgid=,stat=").Output()
+	if err != nil {
+		return nil
+	}
+
+	pids := []int{}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[2], "Z") {
+			continue
+		}
+
+		if pgrp, err := strconv.Atoi(fields[1]); err != nil || pgrp != pgid {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(fields[0]); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
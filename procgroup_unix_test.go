@@ -0,0 +1,27 @@
+//go:build !windows
+
+package gfmrun
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPsProcessGroupMembers(t *testing.T) {
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip("ps is not available")
+	}
+
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd)
+	assert.Nil(t, cmd.Start())
+
+	assert.Equal(t, []int{cmd.Process.Pid}, psProcessGroupMembers(cmd.Process.Pid))
+
+	assert.Nil(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+
+	assert.Equal(t, []int{}, psProcessGroupMembers(cmd.Process.Pid))
+}
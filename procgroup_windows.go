@@ -0,0 +1,39 @@
+//go:build windows
+
+package gfmrun
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// interruptSignals are the signals that may be given by name in the
+// "signals" of an "interrupt" tag, of which only KILL is sent on windows
+var interruptSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+// setProcessGroup makes the command the root of a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// signalProcessGroup kills the started command, as other signals and the
+// descendants of the command cannot be reached on windows
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return nil
+	}
+
+	return cmd.Process.Kill()
+}
+
+// processGroupMembers always returns nil, as the descendants of a command are
+// not tracked on windows
+func processGroupMembers(_ int) []int {
+	return nil
+}
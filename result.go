@@ -0,0 +1,271 @@
+package gfmrun
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Status is the outcome of running a single example
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Result is the result of running (or extracting) a single example
+type Result struct {
+	Runnable   *Runnable
+	Status     Status
+	Retcode    int
+	Error      error
+	Stdout     string
+	Stderr     string
+	Duration   time.Duration
+	SkipReason string
+	Tags       map[string]interface{}
+
+	// Cached is true when the example was not run because it passed before
+	// and nothing it depends on has changed since
+	Cached bool
+}
+
+func (res *Result) finalize() *Result {
+	res.Status = StatusPass
+	res.SkipReason = ""
+
+	if res.Runnable != nil {
+		res.Tags = res.Runnable.Tags
+	}
+
+	switch v := res.Error.(type) {
+	case nil:
+	case *SkipError:
+		res.Status = StatusSkip
+		res.SkipReason = v.Reason
+	default:
+		res.Status = StatusFail
+	}
+
+	return res
+}
+
+// Report is the result of running all examples in all sources of a Runner
+type Report struct {
+	Results  []*Result
+	Errors   []error
+	Duration time.Duration
+}
+
+// Failed returns the results of examples that failed
+func (rep *Report) Failed() []*Result {
+	return rep.withStatus(StatusFail)
+}
+
+// Skipped returns the results of examples that were skipped
+func (rep *Report) Skipped() []*Result {
+	return rep.withStatus(StatusSkip)
+}
+
+// Err returns all errors as one, or nil if there were none
+func (rep *Report) Err() error {
+	return joinErrors(rep.Errors)
+}
+
+func (rep *Report) withStatus(status Status) []*Result {
+	res := []*Result{}
+	for _, result := range rep.Results {
+		if result != nil && result.Status == status {
+			res = append(res, result)
+		}
+	}
+	return res
+}
+
+// SkipError is the error of a Result for an example that was not run
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("skipped because %s", e.Reason)
+}
+
+// TimeoutError is the error of a Result for an example that was killed because
+// it did not finish within its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v", e.Timeout)
+}
+
+// UncleanExitError is the error of an example with an "interrupt" tag that
+// expects a clean exit but did not exit successfully once signaled
+type UncleanExitError struct {
+	Signals []string
+	Err     error
+}
+
+func (e *UncleanExitError) Error() string {
+	return fmt.Sprintf("expected a clean exit when interrupted with %s: %v", strings.Join(e.Signals, ", "), e.Err)
+}
+
+func (e *UncleanExitError) Unwrap() error {
+	return e.Err
+}
+
+// ReadyError is the error of an example with a "ready" tag that did not meet
+// its readiness condition within the timeout or exited before it did
+type ReadyError struct {
+	Condition string
+	Timeout   time.Duration
+	Exited    bool
+}
+
+func (e *ReadyError) Error() string {
+	if e.Exited {
+		return fmt.Sprintf("example exited before it was ready (waiting for %s)", e.Condition)
+	}
+
+	return fmt.Sprintf("example was not ready within %v (waiting for %s)", e.Timeout, e.Condition)
+}
+
+// ProbeError is the error of a request of a "probe" tag that failed or whose
+// response did not have the expected status or body
+type ProbeError struct {
+	Method         string
+	URL            string
+	Err            error
+	Status         int
+	ExpectedStatus int
+	Body           string
+	ExpectedBody   string
+}
+
+func (e *ProbeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("probe %s %s: %v", e.Method, e.URL, e.Err)
+	}
+
+	if e.ExpectedStatus != 0 && e.Status != e.ExpectedStatus {
+		return fmt.Sprintf("probe %s %s: status %d != %d", e.Method, e.URL, e.Status, e.ExpectedStatus)
+	}
+
+	if e.ExpectedStatus == 0 && (e.Status < 200 || e.Status > 299) {
+		return fmt.Sprintf("probe %s %s: status %d is not 2xx", e.Method, e.URL, e.Status)
+	}
+
+	return fmt.Sprintf("probe %s %s: body does not match: %q ~= %q", e.Method, e.URL, e.ExpectedBody, e.Body)
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// LeakedProcessesError is the error of an example that left processes
+// running after its main command exited, which have since been killed
+type LeakedProcessesError struct {
+	Pids []int
+}
+
+func (e *LeakedProcessesError) Error() string {
+	return fmt.Sprintf("example left %d process(es) running: %v", len(e.Pids), e.Pids)
+}
+
+// OutputMismatchError is the error of a Result for an example whose output did
+// not match what was expected of the given stream ("stdout" or "stderr").  The
+// Diff is only given when exact output was expected, and the Source is where
+// it came from when not a tag, such as a golden file or an output block.
+type OutputMismatchError struct {
+	Stream   string
+	Expected string
+	Actual   string
+	Diff     string
+	Source   string
+}
+
+func (e *OutputMismatchError) Error() string {
+	if e.Diff != "" {
+		if e.Source != "" {
+			return fmt.Sprintf("expected output from %s does not match actual:\n%s", e.Source, e.Diff)
+		}
+
+		return fmt.Sprintf("expected output does not match actual:\n%s", e.Diff)
+	}
+
+	if e.Stream == "stderr" {
+		return fmt.Sprintf("expected error does not match actual: %q ~= %q", e.Expected, e.Actual)
+	}
+
+	return fmt.Sprintf("expected output does not match actual: %q != %q", e.Expected, e.Actual)
+}
+
+// ExitError is the error of a Result for an example whose main command exited
+// unsuccessfully, or with other than the Expected exit codes of an "exit_code"
+// tag, in which case Err is nil if the command exited successfully
+type ExitError struct {
+	Retcode  int
+	Err      *exec.ExitError
+	Expected []int
+}
+
+func (e *ExitError) Error() string {
+	if len(e.Expected) == 1 {
+		return fmt.Sprintf("exit status %d, expected %d", e.Retcode, e.Expected[0])
+	}
+
+	if len(e.Expected) > 1 {
+		return fmt.Sprintf("exit status %d, expected one of %v", e.Retcode, e.Expected)
+	}
+
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Retcode)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+
+	return e.Err
+}
+
+// multiError is the error of a Result for an example with more than one
+// failure, such as a console transcript with several mismatched commands
+type multiError []error
+
+func (e multiError) Error() string {
+	return joinErrors(e).Error()
+}
+
+// As allows errors.As to match any of the errors
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinErrors(errs []error) error {
+	if len(errs) > 0 {
+		msg := make([]string, len(errs))
+		for i, err := range errs {
+			msg[i] = err.Error()
+		}
+		return errors.New(strings.Join(msg, "\n"))
+	}
+
+	return nil
+}
@@ -2,15 +2,21 @@ package gfmrun
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"text/template"
 	"time"
@@ -22,22 +28,40 @@ var (
 	defaultKillDuration = time.Second * 3
 	zeroDuration        = time.Second * 0
 
-	wd, wdErr = os.Getwd()
-)
-
-type skipErr struct {
-	Reason string
-}
-
-func (e *skipErr) Error() string {
-	return fmt.Sprintf("skipped because %s", e.Reason)
-}
-
-func init() {
-	if wdErr != nil {
-		panic(fmt.Sprintf("unable to get working directory: %v", wdErr))
+	// defaultInterruptSignals are sent in turn to interrupt an example, each
+	// after the defaultInterruptGrace has passed since the one before
+	defaultInterruptSignals = []string{"INT", "HUP", "TERM", "KILL"}
+	defaultInterruptGrace   = 500 * time.Millisecond
+
+	// outputWaitDelay is how long output is still collected after a command
+	// exits, after which descendants that inherited its stdout or stderr are
+	// no longer waited for
+	outputWaitDelay = 500 * time.Millisecond
+
+	// cleanEnvAllowlist is the environment that is kept when running with a
+	// clean environment, which is enough to find and run the toolchains of the
+	// known frobs
+	cleanEnvAllowlist = map[string]bool{
+		"APPDATA":        true,
+		"COMSPEC":        true,
+		"GOCACHE":        true,
+		"GOMODCACHE":     true,
+		"GOPATH":         true,
+		"GOPROXY":        true,
+		"GOROOT":         true,
+		"HOME":           true,
+		"JAVA_HOME":      true,
+		"LOCALAPPDATA":   true,
+		"PATH":           true,
+		"PATHEXT":        true,
+		"SYSTEMROOT":     true,
+		"TEMP":           true,
+		"TMP":            true,
+		"TMPDIR":         true,
+		"USERPROFILE":    true,
+		"XDG_CACHE_HOME": true,
 	}
-}
+)
 
 type Runnable struct {
 	Frob       Frob
@@ -49,7 +73,41 @@ type Runnable struct {
 	LineOffset int
 	Lines      []string
 
-	log *logrus.Logger
+	// OutputBlock is the content of a code block adjacent to the example that
+	// is expected to equal the program output (stdout), starting at the line
+	// OutputBlockLineOffset of the source
+	OutputBlock           []string
+	OutputBlockLineOffset int
+
+	// StdinBlock is the content of a code block adjacent to the example with a
+	// declared language of "stdin" that is piped to the program
+	StdinBlock []string
+
+	// HiddenLines are the lines of a "gfmrun:hidden" comment preceding the
+	// example, which are not rendered but are part of the source that is run.
+	// A "gfmrun:example" line marks where the example lines are placed, and
+	// otherwise the hidden lines come first.
+	HiddenLines []string
+
+	// GroupFiles are the code blocks following the example that share its
+	// "group" tag, which are written alongside it as additional files
+	GroupFiles []*Runnable
+
+	adjacentTo *Runnable
+
+	stdout         io.Writer
+	stderr         io.Writer
+	defaultTimeout time.Duration
+	defaultWrap    bool
+	shellSessions  bool
+	goReplace      []string
+	goFlags        []string
+	goWorkspace    *goWorkspace
+	updateGolden   bool
+	cleanEnv       bool
+	service        *service
+	session        *session
+	log            *logrus.Logger
 }
 
 func NewRunnable(sourceName string, log *logrus.Logger) *Runnable {
@@ -62,14 +120,46 @@ func NewRunnable(sourceName string, log *logrus.Logger) *Runnable {
 	}
 }
 
+// String returns the full source of the example, including hidden lines
 func (rn *Runnable) String() string {
-	return strings.Join(rn.Lines, "\n")
+	return strings.Join(rn.SourceLines(), "\n")
+}
+
+// SourceLines returns the lines of the full source of the example, which are
+// the example lines placed within any hidden lines
+func (rn *Runnable) SourceLines() []string {
+	before, after := rn.hiddenSplit()
+	if before == nil && after == nil {
+		return rn.Lines
+	}
+
+	lines := append([]string{}, before...)
+	lines = append(lines, rn.Lines...)
+	return append(lines, after...)
+}
+
+// hiddenSplit returns the hidden lines before and after the place of the
+// example lines
+func (rn *Runnable) hiddenSplit() ([]string, []string) {
+	for i, line := range rn.HiddenLines {
+		if strings.TrimSpace(line) == hiddenExamplePlaceholder {
+			return rn.HiddenLines[:i], rn.HiddenLines[i+1:]
+		}
+	}
+
+	return rn.HiddenLines, nil
+}
+
+// Name identifies the example by its source file, line offset, and language,
+// e.g. "README.md:L42-go"
+func (rn *Runnable) Name() string {
+	return fmt.Sprintf("%s:L%d-%s", rn.SourceFile, rn.LineOffset, rn.Lang)
 }
 
 func (rn *Runnable) GoString() string {
 	rn.parseTags()
 	return fmt.Sprintf("\nsource: %s:%d\ntags: %#v\nlang: %q\n\n%s\n",
-		rn.SourceFile, rn.LineOffset, rn.Tags, rn.Lang, strings.Join(rn.Lines, "\n"))
+		rn.SourceFile, rn.LineOffset, rn.Tags, rn.Lang, rn.String())
 }
 
 func (rn *Runnable) Begin(lineno int, line string) {
@@ -92,12 +182,245 @@ func (rn *Runnable) Interruptable() (bool, time.Duration) {
 			}
 		}
 
+		if _, ok := v.(map[string]interface{}); ok {
+			if intr, err := rn.Interruption(); err == nil {
+				return true, intr.After
+			}
+		}
+
+		return true, defaultKillDuration
+	}
+
+	// examples that are waited for or probed are long-running, such as
+	// servers, and are interrupted once they have been
+	if rn.IsProbed() {
 		return true, defaultKillDuration
 	}
 
 	return false, zeroDuration
 }
 
+// interruption is how a long-running example is stopped
+type interruption struct {
+	After           time.Duration
+	Signals         []string
+	Grace           time.Duration
+	ExpectCleanExit bool
+}
+
+// Interruption returns how the example is interrupted, which is given by an
+// "interrupt" tag object with the duration to interrupt the program "after",
+// the "signals" to send in turn (any not stopping it are followed by KILL),
+// the "grace" duration to wait after each signal, and whether to
+// "expect_clean_exit", that is for the program to exit successfully once
+// signaled.  Other values of the tag only set the duration.
+func (rn *Runnable) Interruption() (*interruption, error) {
+	rn.parseTags()
+
+	intr := &interruption{
+		After:   defaultKillDuration,
+		Signals: defaultInterruptSignals,
+		Grace:   defaultInterruptGrace,
+	}
+
+	v, ok := rn.Tags["interrupt"].(map[string]interface{})
+	if !ok {
+		if interruptable, dur := rn.Interruptable(); interruptable {
+			intr.After = dur
+		}
+
+		return intr, nil
+	}
+
+	for key, dest := range map[string]*time.Duration{"after": &intr.After, "grace": &intr.Grace} {
+		if sv, ok := v[key].(string); ok {
+			dv, err := time.ParseDuration(sv)
+			if err != nil {
+				return nil, fmt.Errorf("interrupt tag %q: %w", key, err)
+			}
+			*dest = dv
+		}
+	}
+
+	if signals, ok := v["signals"].([]interface{}); ok {
+		intr.Signals = []string{}
+
+		for _, iv := range signals {
+			name, _ := iv.(string)
+			name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+
+			if _, ok := interruptSignals[name]; !ok {
+				return nil, fmt.Errorf("interrupt tag: unknown signal %q", iv)
+			}
+
+			intr.Signals = append(intr.Signals, name)
+		}
+	}
+
+	intr.ExpectCleanExit, _ = v["expect_clean_exit"].(bool)
+
+	return intr, nil
+}
+
+// IsProbed is true when the example has a "ready" or "probe" tag, so that it is
+// interrupted once ready and probed rather than after the interrupt duration
+func (rn *Runnable) IsProbed() bool {
+	rn.parseTags()
+	_, ready := rn.Tags["ready"]
+	_, probe := rn.Tags["probe"]
+	return ready || probe
+}
+
+// Timeout returns the maximum duration allowed for running all of the
+// commands of the example, which is either the value of the "timeout" tag or
+// the default given by the Runner.  A zero value means there is no limit.
+func (rn *Runnable) Timeout() time.Duration {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["timeout"]; ok {
+		if sv, ok := v.(string); ok {
+			if dv, err := time.ParseDuration(sv); err == nil {
+				return dv
+			}
+		}
+
+		rn.log.WithField("timeout", v).Warn("failed to parse timeout tag")
+	}
+
+	return rn.defaultTimeout
+}
+
+// Wrap returns the value of the "wrap" tag, which checks Go snippets that are
+// not a main package, or the default given by the Runner
+func (rn *Runnable) Wrap() bool {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["wrap"]; ok {
+		if bv, ok := v.(bool); ok {
+			return bv
+		}
+
+		rn.log.WithField("wrap", v).Warn("failed to parse wrap tag")
+	}
+
+	return rn.defaultWrap
+}
+
+// ShellSession returns the value of the "shell_session" tag, which runs
+// console transcripts, or the default given by the Runner
+func (rn *Runnable) ShellSession() bool {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["shell_session"]; ok {
+		if bv, ok := v.(bool); ok {
+			return bv
+		}
+
+		rn.log.WithField("shell_session", v).Warn("failed to parse shell_session tag")
+	}
+
+	return rn.shellSessions
+}
+
+// GoBuildFlags returns the flags given to the go tool when building or
+// checking a Go example, which are the flags given by the Runner followed by
+// the "go_build_flags" tag, the "go_tags" tag as -tags, and -race when the
+// "go_race" tag is true
+func (rn *Runnable) GoBuildFlags() []string {
+	rn.parseTags()
+
+	flags := append([]string{}, rn.goFlags...)
+
+	switch v := rn.Tags["go_build_flags"].(type) {
+	case string:
+		tagFlags, err := splitGoFlags(v)
+		if err != nil {
+			rn.log.WithField("go_build_flags", v).Warn("failed to parse go_build_flags tag")
+		}
+		flags = append(flags, tagFlags...)
+	case []interface{}:
+		for _, iv := range v {
+			if s, ok := iv.(string); ok {
+				flags = append(flags, s)
+			}
+		}
+	}
+
+	switch v := rn.Tags["go_tags"].(type) {
+	case string:
+		if v != "" {
+			flags = append(flags, "-tags="+v)
+		}
+	case []interface{}:
+		tags := []string{}
+		for _, iv := range v {
+			if s, ok := iv.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		if len(tags) > 0 {
+			flags = append(flags, "-tags="+strings.Join(tags, ","))
+		}
+	}
+
+	if race, _ := rn.Tags["go_race"].(bool); race {
+		flags = append(flags, "-race")
+	}
+
+	return flags
+}
+
+// Group returns the value of the "group" tag, which joins consecutive code
+// blocks into a single example with several files
+func (rn *Runnable) Group() string {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["group"]; ok {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// FileName returns the name of the file the example is written to relative to
+// its temporary directory, which is the value of the "file" tag when present
+func (rn *Runnable) FileName() (string, error) {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["file"]; ok {
+		if s, ok := v.(string); ok && s != "" {
+			name, err := localPath(s)
+			if err != nil {
+				return "", fmt.Errorf("file tag %w", err)
+			}
+			return name, nil
+		}
+	}
+
+	return rn.Frob.TempFileName(rn), nil
+}
+
+// addGroupFile merges a code block of the same group into the example,
+// adding any of its tags that the example does not already have
+func (rn *Runnable) addGroupFile(part *Runnable) {
+	rn.parseTags()
+	part.parseTags()
+
+	for key, value := range part.Tags {
+		if key == "file" || key == "group" {
+			continue
+		}
+
+		if _, ok := rn.Tags[key]; !ok {
+			rn.Tags[key] = value
+		}
+	}
+
+	rn.GroupFiles = append(rn.GroupFiles, part)
+}
+
 func (rn *Runnable) Args() []string {
 	rn.parseTags()
 
@@ -114,6 +437,74 @@ func (rn *Runnable) Args() []string {
 	return nil
 }
 
+// Stdin returns the input piped to the program, which is the value of the
+// "stdin" tag, the contents of the file named by the "stdin_file" tag relative
+// to the markdown source, or the stdin block, in that order of precedence
+func (rn *Runnable) Stdin() (io.Reader, error) {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["stdin"]; ok {
+		if s, ok := v.(string); ok {
+			return strings.NewReader(s), nil
+		}
+	}
+
+	if v, ok := rn.Tags["stdin_file"]; ok {
+		if s, ok := v.(string); ok && s != "" {
+			stdinBytes, err := os.ReadFile(rn.sourceRelativePath(s))
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(stdinBytes), nil
+		}
+	}
+
+	if rn.StdinBlock != nil {
+		return strings.NewReader(strings.Join(rn.StdinBlock, "\n") + "\n"), nil
+	}
+
+	return nil, nil
+}
+
+// Env returns the "KEY=value" pairs of the "env" tag, sorted by key, which are
+// added to the environment of all of the example's commands
+func (rn *Runnable) Env() []string {
+	rn.parseTags()
+
+	v, ok := rn.Tags["env"]
+	if !ok {
+		return nil
+	}
+
+	mv, ok := v.(map[string]interface{})
+	if !ok {
+		rn.log.WithField("env", v).Warn("failed to parse env tag")
+		return nil
+	}
+
+	keys := []string{}
+	for key := range mv {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	env := []string{}
+	for _, key := range keys {
+		value := fmt.Sprintf("%v", mv[key])
+
+		// numbers are written as they are in the tag rather than in the
+		// exponent form of large floats, such as 1e+06
+		if f, ok := mv[key].(float64); ok {
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	return env
+}
+
 func (rn *Runnable) ExpectedOutput() *regexp.Regexp {
 	rn.parseTags()
 
@@ -126,6 +517,76 @@ func (rn *Runnable) ExpectedOutput() *regexp.Regexp {
 	return nil
 }
 
+// ExpectedOutputExact returns the value of the "output_exact" tag, which the
+// program output (stdout) must equal exactly
+func (rn *Runnable) ExpectedOutputExact() (string, bool) {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["output_exact"]; ok {
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+	}
+
+	return "", false
+}
+
+// ExpectedOutputFile returns the path of the golden file named by the
+// "output_file" tag relative to the markdown source, which the program output
+// (stdout) must equal exactly
+func (rn *Runnable) ExpectedOutputFile() string {
+	rn.parseTags()
+
+	if v, ok := rn.Tags["output_file"]; ok {
+		if s, ok := v.(string); ok && s != "" {
+			return rn.sourceRelativePath(s)
+		}
+	}
+
+	return ""
+}
+
+func (rn *Runnable) sourceRelativePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(rn.SourceFile), filepath.FromSlash(path))
+}
+
+// ExpectedExitCodes returns the value of the "exit_code" tag, which is either
+// a single exit code or a list of exit codes that the program may exit with
+func (rn *Runnable) ExpectedExitCodes() ([]int, bool) {
+	rn.parseTags()
+
+	v, ok := rn.Tags["exit_code"]
+	if !ok {
+		return nil, false
+	}
+
+	switch val := v.(type) {
+	case float64:
+		return []int{int(val)}, true
+	case []interface{}:
+		codes := []int{}
+		for _, iv := range val {
+			if fv, ok := iv.(float64); ok {
+				codes = append(codes, int(fv))
+			}
+		}
+
+		if len(codes) == 0 {
+			rn.log.WithField("exit_code", v).Warn("no exit codes in exit_code tag")
+			return nil, false
+		}
+
+		return codes, true
+	default:
+		rn.log.WithField("exit_code", v).Warn("failed to parse exit_code tag")
+		return nil, false
+	}
+}
+
 func (rn *Runnable) ExpectedError() *regexp.Regexp {
 	rn.parseTags()
 
@@ -175,71 +636,175 @@ func (rn *Runnable) parseTags() {
 	}
 }
 
-func (rn *Runnable) Extract(i int, dir string) *runResult {
+func (rn *Runnable) Extract(i int, dir string) *Result {
+	return rn.extract(i, dir).finalize()
+}
+
+func (rn *Runnable) extract(i int, dir string) *Result {
 	if dir == "" {
 		dir = "."
 	}
 
-	outFileName := filepath.Join(dir, fmt.Sprintf("%03d%s", i+1, rn.Frob.TempFileName(rn)))
+	fileName, err := rn.FileName()
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	// the files of a group are extracted to a directory of their own at
+	// their relative paths, as files in different directories may have the
+	// same base name
+	extractedFileName := func(fileName string) (string, error) {
+		if len(rn.GroupFiles) == 0 {
+			return filepath.Join(dir, fmt.Sprintf("%03d%s", i+1, filepath.Base(fileName))), nil
+		}
+
+		outFileName := filepath.Join(dir, fmt.Sprintf("%03d", i+1), fileName)
+		return outFileName, os.MkdirAll(filepath.Dir(outFileName), 0755)
+	}
+
+	outFileName, err := extractedFileName(fileName)
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
 
 	rn.log.WithFields(logrus.Fields{
 		"filename": outFileName,
 	}).Info("extracting example")
 
-	err := os.WriteFile(outFileName, []byte(rn.String()), os.FileMode(0600))
+	source, err := rn.transformedSource()
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	err = os.WriteFile(outFileName, []byte(source), os.FileMode(0600))
 	if err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	for _, part := range rn.GroupFiles {
+		part.Frob = rn.Frob
+
+		partFileName, err := part.FileName()
+		if err != nil {
+			return &Result{Runnable: rn, Retcode: -1, Error: err}
+		}
+
+		outFileName, err := extractedFileName(partFileName)
+		if err != nil {
+			return &Result{Runnable: rn, Retcode: -1, Error: err}
+		}
+
+		rn.log.WithFields(logrus.Fields{
+			"filename": outFileName,
+		}).Info("extracting example group file")
+
+		err = os.WriteFile(outFileName, []byte(part.String()), os.FileMode(0600))
+		if err != nil {
+			return &Result{Runnable: rn, Retcode: -1, Error: err}
+		}
 	}
 
-	return &runResult{Runnable: rn, Retcode: 0}
+	return &Result{Runnable: rn, Retcode: 0}
+}
+
+func (rn *Runnable) Run(i int) *Result {
+	return rn.RunContext(context.Background(), i)
+}
+
+// RunContext runs the example, killing any of its commands that are still
+// running when the context is done or the example's timeout has elapsed
+func (rn *Runnable) RunContext(ctx context.Context, i int) *Result {
+	return rn.run(ctx, i).finalize()
 }
 
-func (rn *Runnable) Run(i int) *runResult {
+func (rn *Runnable) run(ctx context.Context, i int) *Result {
+	if err := ctx.Err(); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
 	if !rn.IsValidOS() {
-		return &runResult{
+		return &Result{
 			Runnable: rn,
 			Retcode:  0,
-			Error:    &skipErr{Reason: "os not supported"},
+			Error:    &SkipError{Reason: "os not supported"},
 		}
 	}
 
 	if interruptable, _ := rn.Interruptable(); interruptable && runtime.GOOS == "windows" {
-		return &runResult{
+		return &Result{
 			Runnable: rn,
 			Retcode:  0,
-			Error:    &skipErr{Reason: "interrupt tag is not supported on windows"},
+			Error:    &SkipError{Reason: "interrupt tag is not supported on windows"},
 		}
 	}
 
+	if _, err := rn.Interruption(); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
 	baseTmp := filepath.Join(os.TempDir(), "gfmrun")
 	if err := os.MkdirAll(baseTmp, 0755); err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
 	}
 
 	tmpDir, err := os.MkdirTemp(baseTmp, "tmp.*")
 	if err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
 	}
 
 	defer func() {
+		// a running service still needs its files until it is stopped
+		if rn.service != nil {
+			rn.service.tmpDir = tmpDir
+			return
+		}
+
 		if os.Getenv("GFMRUN_PRESERVE_TMPFILES") == "1" {
 			return
 		}
 		_ = os.RemoveAll(tmpDir)
 	}()
 
-	tmpFilename := rn.Frob.TempFileName(rn)
+	// examples of a session are built in a directory of their own but run
+	// from the session directory
+	workDir := tmpDir
+	if rn.session != nil {
+		workDir = rn.session.Dir
+	}
+
+	if err := rn.writeFixtures(workDir); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	tmpFilename, err := rn.FileName()
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, tmpFilename)), 0755); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
 	tmpFile, err := os.Create(filepath.Join(tmpDir, tmpFilename))
 	if err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	source, err := rn.transformedSource()
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
 	}
 
-	if _, err := tmpFile.Write([]byte(rn.String())); err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+	if _, err := tmpFile.Write([]byte(source)); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
 	}
 
 	if err := tmpFile.Close(); err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	if err := rn.writeGroupFiles(tmpDir); err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
 	}
 
 	nameBase := strings.Replace(tmpFile.Name(), "."+rn.Frob.Extension(), "", 1)
@@ -255,30 +820,73 @@ func (rn *Runnable) Run(i int) *runResult {
 		"NAMEBASE": nameBase,
 	}
 
+	// the Main command of a shell example of a session runs a wrapper that
+	// sources the example instead
+	mainVars := tmplVars
+
+	sessionShell := rn.session != nil && rn.SessionShell()
+	if sessionShell {
+		wrapperFile := filepath.Join(tmpDir, "session-wrapper."+rn.Frob.Extension())
+		if err := os.WriteFile(wrapperFile, []byte(sessionShellWrapper), os.FileMode(0644)); err != nil {
+			return &Result{Runnable: rn, Retcode: -1, Error: err}
+		}
+
+		mainVars = map[string]string{}
+		for key, value := range tmplVars {
+			mainVars[key] = value
+		}
+		mainVars["FILE"] = wrapperFile
+	}
+
 	for _, c := range rn.Frob.Commands(rn) {
+		vars := tmplVars
+		if c.Main {
+			vars = mainVars
+		}
+
 		expandedArgs := []string{}
 		for _, s := range c.Args {
-			buf := &bytes.Buffer{}
-			err = template.Must(template.New("tmp").Parse(s)).Execute(buf, tmplVars)
+			expanded, err := expandTemplate(s, vars)
 			if err != nil {
-				return &runResult{Runnable: rn, Retcode: -1, Error: err}
+				return &Result{Runnable: rn, Retcode: -1, Error: err}
 			}
-			expandedArgs = append(expandedArgs, buf.String())
+			expandedArgs = append(expandedArgs, expanded)
 		}
+
+		dir := tmpDir
+		if c.Main {
+			dir = workDir
+			if sessionShell && rn.session.WorkDir != "" {
+				dir = rn.session.WorkDir
+			}
+		}
+
+		if c.Dir != "" {
+			dir, err = expandTemplate(c.Dir, tmplVars)
+			if err != nil {
+				return &Result{Runnable: rn, Retcode: -1, Error: err}
+			}
+		}
+
 		expandedCommands = append(expandedCommands,
 			&command{
 				Main: c.Main,
 				Args: expandedArgs,
+				Dir:  dir,
 			})
 	}
 
 	env := os.Environ()
+	if rn.cleanEnv {
+		env = cleanEnviron(env)
+	}
+
 	env = append(env, rn.Frob.Environ(rn)...)
 	env = append(env,
 		fmt.Sprintf("GFMRUN_BASENAME=%s", filepath.Base(tmpFile.Name())),
 		fmt.Sprintf("BASENAME=%s", filepath.Base(tmpFile.Name())),
-		fmt.Sprintf("GFMRUN_DIR=%s", tmpDir),
-		fmt.Sprintf("DIR=%s", tmpDir),
+		fmt.Sprintf("GFMRUN_DIR=%s", workDir),
+		fmt.Sprintf("DIR=%s", workDir),
 		fmt.Sprintf("GFMRUN_EXT=%s", rn.Frob.Extension()),
 		fmt.Sprintf("EXT=%s", rn.Frob.Extension()),
 		fmt.Sprintf("GFMRUN_FILE=%s", tmpFile.Name()),
@@ -286,117 +894,226 @@ func (rn *Runnable) Run(i int) *runResult {
 		fmt.Sprintf("GFMRUN_NAMEBASE=%s", nameBase),
 		fmt.Sprintf("NAMEBASE=%s", nameBase))
 
-	defer func() { _ = os.Chdir(wd) }()
-	if err = os.Chdir(tmpDir); err != nil {
-		return &runResult{Runnable: rn, Retcode: -1, Error: err}
+	if !sessionShell {
+		return rn.updateGoldenFile(rn.executeCommands(ctx, append(env, rn.Env()...), expandedCommands))
 	}
 
-	return rn.executeCommands(env, expandedCommands)
+	stateFile := filepath.Join(tmpDir, "session-state")
+	baseEnv := append(append([]string{}, env...), rn.Env()...)
+
+	env = append(env, rn.session.Env...)
+	env = append(env, fmt.Sprintf("GFMRUN_SESSION_STATE=%s", stateFile))
+	env = append(env, rn.Env()...)
+
+	res := rn.updateGoldenFile(rn.executeCommands(ctx, env, expandedCommands))
+	rn.session.load(stateFile, baseEnv)
+	return res
 }
 
-func (rn *Runnable) executeCommands(env []string, commands []*command) *runResult {
-	outBuf := &bytes.Buffer{}
-	errBuf := &bytes.Buffer{}
-	var err error
-	interruptable := false
-	interrupted := false
+// writeGroupFiles writes the other code blocks of the example's group to dir
+func (rn *Runnable) writeGroupFiles(dir string) error {
+	for _, part := range rn.GroupFiles {
+		part.Frob = rn.Frob
+
+		partFileName, err := part.FileName()
+		if err != nil {
+			return err
+		}
+
+		partPath := filepath.Join(dir, partFileName)
+		if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(partPath, []byte(part.String()), os.FileMode(0644)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanEnviron returns only the allowlisted "KEY=value" pairs of env
+func cleanEnviron(env []string) []string {
+	clean := []string{}
+
+	for _, pair := range env {
+		key, _, _ := strings.Cut(pair, "=")
+		if cleanEnvAllowlist[strings.ToUpper(key)] {
+			clean = append(clean, pair)
+		}
+	}
+
+	return clean
+}
+
+// transformedSource is the source that is written to the file that is run,
+// which is the example source unless the frob transforms it
+func (rn *Runnable) transformedSource() (string, error) {
+	if t, ok := rn.Frob.(SourceTransformer); ok {
+		return t.TransformSource(rn)
+	}
+
+	return rn.String(), nil
+}
+
+func expandTemplate(s string, vars map[string]string) (string, error) {
+	buf := &bytes.Buffer{}
+	err := template.Must(template.New("tmp").Parse(s)).Execute(buf, vars)
+	return buf.String(), err
+}
+
+func (rn *Runnable) executeCommands(ctx context.Context, env []string, commands []*command) *Result {
+	outBuf := &syncBuffer{}
+	errBuf := &syncBuffer{}
+	var err, leakErr, probeErr error
+	var signals []string
+	mainRan := false
+	interruptable, dur := rn.Interruptable()
+
+	stdin, err := rn.Stdin()
+	if err != nil {
+		return &Result{Runnable: rn, Retcode: -1, Error: err}
+	}
+
+	timeout := rn.Timeout()
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	rn.log.WithFields(logrus.Fields{
 		"runnable": rn.GoString(),
 	}).Debug("running runnable")
 
 	for _, c := range commands {
+		if runCtx.Err() != nil {
+			break
+		}
+
 		args := c.Args[1:]
 
 		if tagArgs := rn.Args(); c.Main && tagArgs != nil {
 			args = append(args, tagArgs...)
 		}
 
-		cmd := exec.Command(c.Args[0], args...)
+		var cmd *exec.Cmd
+		if c.Main {
+			// Main commands are run in a process group of their own so that
+			// their descendants are signaled and cleaned up along with them
+			cmd = exec.Command(c.Args[0], args...)
+			setProcessGroup(cmd)
+		} else {
+			cmd = exec.CommandContext(runCtx, c.Args[0], args...)
+		}
+
+		cmd.Dir = c.Dir
 		cmd.Env = env
-		cmd.Stdout = outBuf
-		cmd.Stderr = errBuf
+
+		stdout, stderr := io.Writer(outBuf), io.Writer(errBuf)
+
+		if c.Main && stdin != nil {
+			cmd.Stdin = stdin
+		}
 
 		if !c.Main {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			stdout, stderr = rn.stdout, rn.stderr
+
+			if stdout == nil {
+				stdout = os.Stdout
+			}
+
+			if stderr == nil {
+				stderr = os.Stderr
+			}
 		}
 
 		rn.log.WithFields(logrus.Fields{
 			"command": c.Args,
 		}).Debug("running runnable command")
 
-		interruptable, dur := rn.Interruptable()
+		if c.Main && rn.ServiceName() != "" {
+			rn.log.WithFields(logrus.Fields{
+				"cmd":     cmd,
+				"service": rn.ServiceName(),
+			}).Debug("starting service")
 
-		if c.Main && interruptable {
+			st := rn.startService(runCtx, cmd, stdout, stderr, outBuf)
+			err, probeErr = st.Err, st.ProbeErr
+		} else if c.Main && interruptable {
 			rn.log.WithFields(logrus.Fields{
 				"cmd": cmd,
 				"dur": dur,
 			}).Debug("running with `Start`")
 
-			err = cmd.Start()
-			time.Sleep(dur)
-
-			for _, sig := range []syscall.Signal{
-				syscall.SIGINT,
-				syscall.SIGHUP,
-				syscall.SIGTERM,
-				syscall.SIGKILL,
-			} {
-				if cmd.Process == nil {
-					rn.log.WithFields(logrus.Fields{
-						"signal": sig,
-						"cmd":    cmd,
-					}).Debug("breaking due to missing process")
-					break
-				}
-
-				rn.log.WithFields(logrus.Fields{
-					"signal": sig,
-				}).Debug("attempting signal")
-
-				sigErr := cmd.Process.Signal(sig)
-
-				if sigErr != nil {
-					rn.log.WithFields(logrus.Fields{
-						"signal": sig,
-						"err":    sigErr,
-					}).Debug("signal returned error")
-
-					time.Sleep(500 * time.Millisecond)
-					continue
-				}
-
-				proc, _ := os.FindProcess(cmd.Process.Pid)
-				sigErr = proc.Signal(syscall.Signal(0))
-				if sigErr != nil && sigErr.Error() == "no such process" {
-					interrupted = true
-					break
-				}
-				time.Sleep(500 * time.Millisecond)
-			}
+			st := rn.startAndInterrupt(runCtx, cmd, stdout, stderr, dur, outBuf)
+			err, probeErr, signals = st.Err, st.ProbeErr, st.Signals
 		} else if !c.Main {
 			rn.log.WithField("cmd", cmd).Debug("running non-Main with `Run`")
-			err = cmd.Run()
+			err = runCommand(cmd, stdout, stderr)
 		} else {
 			rn.log.WithField("cmd", cmd).Debug("running with `Run`")
-			err = cmd.Run()
+			err = runProcessGroup(runCtx, cmd, stdout, stderr)
+		}
+
+		if c.Main {
+			mainRan = true
+			if rn.service == nil {
+				leakErr = rn.reapProcessGroup(cmd)
+			}
 		}
 	}
 
-	res := &runResult{
+	res := &Result{
 		Runnable: rn,
 		Retcode:  -1,
 		Stdout:   outBuf.String(),
 		Stderr:   errBuf.String(),
 	}
 
+	if runErr := runCtx.Err(); runErr != nil {
+		res.Error = runErr
+		if errors.Is(runErr, context.DeadlineExceeded) && ctx.Err() == nil {
+			res.Error = &TimeoutError{Timeout: timeout}
+		}
+
+		return res
+	}
+
+	if leakErr != nil {
+		res.Error = leakErr
+		return res
+	}
+
+	if probeErr != nil {
+		res.Error = probeErr
+		return res
+	}
+
+	if checker, ok := rn.Frob.(OutputChecker); ok {
+		checkErr := checker.CheckOutput(rn, res.Stdout, res.Stderr)
+
+		if cleaner, ok := rn.Frob.(outputCleaner); ok {
+			res.Stdout = cleaner.cleanOutput(res.Stdout)
+		}
+
+		if checkErr != nil {
+			res.Error = checkErr
+			return res
+		}
+	}
+
 	expectedOutput := rn.ExpectedOutput()
 
 	if expectedOutput != nil {
 		if !expectedOutput.MatchString(res.Stdout) {
-			res.Error = fmt.Errorf("expected output does not match actual: %q != %q",
-				expectedOutput, res.Stdout)
+			res.Error = &OutputMismatchError{
+				Stream:   "stdout",
+				Expected: expectedOutput.String(),
+				Actual:   res.Stdout,
+			}
 			return res
 		} else {
 			rn.log.WithFields(logrus.Fields{
@@ -406,12 +1123,25 @@ func (rn *Runnable) executeCommands(env []string, commands []*command) *runResul
 		}
 	}
 
+	if err := rn.checkOutputBlock(res.Stdout); err != nil {
+		res.Error = err
+		return res
+	}
+
+	if err := rn.checkExactOutput(res.Stdout); err != nil {
+		res.Error = err
+		return res
+	}
+
 	expectedError := rn.ExpectedError()
 
 	if expectedError != nil {
 		if !expectedError.MatchString(res.Stderr) {
-			res.Error = fmt.Errorf("expected error does not match actual: %q ~= %q",
-				expectedError, res.Stderr)
+			res.Error = &OutputMismatchError{
+				Stream:   "stderr",
+				Expected: expectedError.String(),
+				Actual:   res.Stderr,
+			}
 		} else {
 			rn.log.WithFields(logrus.Fields{
 				"expected": fmt.Sprintf("%q", expectedError.String()),
@@ -420,15 +1150,34 @@ func (rn *Runnable) executeCommands(env []string, commands []*command) *runResul
 		}
 	}
 
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.Success() {
-			res.Retcode = 0
+	if expectedCodes, ok := rn.ExpectedExitCodes(); ok {
+		if !mainRan {
+			res.Error = err
 			return res
 		}
 
-		res.Error = err
-		if interrupted && interruptable || expectedError != nil {
-			res.Error = nil
+		return rn.checkExitCode(res, err, expectedCodes)
+	}
+
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if exitErr.Success() {
+				res.Retcode = 0
+				return res
+			}
+
+			res.Retcode = exitErr.ExitCode()
+			err = &ExitError{Retcode: res.Retcode, Err: exitErr}
+		}
+
+		if !interruptable && expectedError == nil {
+			res.Error = err
+		} else if intr, _ := rn.Interruption(); interruptable && intr.ExpectCleanExit {
+			// a program that exited before it was signaled simply failed
+			res.Error = err
+			if len(signals) > 0 {
+				res.Error = &UncleanExitError{Signals: signals, Err: err}
+			}
 		}
 
 		return res
@@ -438,10 +1187,456 @@ func (rn *Runnable) executeCommands(env []string, commands []*command) *runResul
 	return res
 }
 
-type runResult struct {
-	Runnable *Runnable
-	Retcode  int
-	Error    error
-	Stdout   string
-	Stderr   string
+// checkExitCode asserts that the Main command exited with one of the expected
+// exit codes, whether or not it was interrupted.  A mismatched "error" tag is
+// still reported when the exit code is as expected.
+func (rn *Runnable) checkExitCode(res *Result, err error, expectedCodes []int) *Result {
+	var exitErr *exec.ExitError
+	res.Retcode = 0
+
+	if err != nil {
+		if !errors.As(err, &exitErr) {
+			res.Retcode = -1
+			res.Error = err
+			return res
+		}
+
+		res.Retcode = exitErr.ExitCode()
+	}
+
+	for _, code := range expectedCodes {
+		if code == res.Retcode {
+			return res
+		}
+	}
+
+	res.Error = &ExitError{Retcode: res.Retcode, Err: exitErr, Expected: expectedCodes}
+	return res
+}
+
+// checkOutputBlock compares the program output to the output block, ignoring
+// a final newline, or ignoring trailing whitespace and surrounding blank lines
+// when the "output_normalize" tag is truthy
+func (rn *Runnable) checkOutputBlock(stdout string) error {
+	if rn.OutputBlock == nil {
+		return nil
+	}
+
+	rn.parseTags()
+
+	expected := strings.Join(rn.OutputBlock, "\n")
+	actual := strings.TrimSuffix(stdout, "\n")
+
+	if normalize, _ := rn.Tags["output_normalize"].(bool); normalize {
+		expected = normalizeOutput(expected)
+		actual = normalizeOutput(actual)
+	}
+
+	if expected == actual {
+		return nil
+	}
+
+	return &OutputMismatchError{
+		Stream:   "stdout",
+		Expected: expected,
+		Actual:   actual,
+		Diff:     unifiedDiff(expected, actual),
+		Source:   fmt.Sprintf("%s:%d", rn.SourceFile, rn.OutputBlockLineOffset),
+	}
+}
+
+func normalizeOutput(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// checkExactOutput compares the program output to the "output_exact" tag and
+// to the golden file of the "output_file" tag, unless golden files are being
+// updated
+func (rn *Runnable) checkExactOutput(stdout string) error {
+	if expected, ok := rn.ExpectedOutputExact(); ok && expected != stdout {
+		return &OutputMismatchError{
+			Stream:   "stdout",
+			Expected: expected,
+			Actual:   stdout,
+			Diff:     unifiedDiff(expected, stdout),
+		}
+	}
+
+	goldenFile := rn.ExpectedOutputFile()
+	if goldenFile == "" || rn.updateGolden {
+		return nil
+	}
+
+	expectedBytes, err := os.ReadFile(goldenFile)
+	if err != nil {
+		return err
+	}
+
+	if expected := string(expectedBytes); expected != stdout {
+		return &OutputMismatchError{
+			Stream:   "stdout",
+			Expected: expected,
+			Actual:   stdout,
+			Diff:     unifiedDiff(expected, stdout),
+			Source:   goldenFile,
+		}
+	}
+
+	return nil
+}
+
+// updateGoldenFile rewrites the golden file of the "output_file" tag with the
+// program output when updating golden files, but only once the example passed
+func (rn *Runnable) updateGoldenFile(res *Result) *Result {
+	goldenFile := rn.ExpectedOutputFile()
+	if !rn.updateGolden || goldenFile == "" || res.Error != nil {
+		return res
+	}
+
+	if existing, err := os.ReadFile(goldenFile); err == nil && string(existing) == res.Stdout {
+		return res
+	}
+
+	rn.log.WithField("file", goldenFile).Info("updating golden file")
+
+	if err := os.MkdirAll(filepath.Dir(goldenFile), 0755); err != nil {
+		res.Error = err
+		return res
+	}
+
+	if err := os.WriteFile(goldenFile, []byte(res.Stdout), os.FileMode(0644)); err != nil {
+		res.Error = err
+	}
+
+	return res
+}
+
+// started is the outcome of a Main command that was started rather than run
+type started struct {
+	// Err is the error of starting the command or of its exit
+	Err error
+
+	// ProbeErr is the error of becoming ready or of the probes for an example
+	// with a "ready" or "probe" tag
+	ProbeErr error
+
+	// Signals are the signals that were sent to interrupt the command, if
+	// any, as it may have exited on its own first
+	Signals []string
+}
+
+// startAndInterrupt starts the command and, unless it exits on its own first,
+// interrupts it via increasingly serious signals after the given duration or,
+// for an example with a "ready" or "probe" tag, once it has been probed
+func (rn *Runnable) startAndInterrupt(ctx context.Context, cmd *exec.Cmd, stdout, stderr io.Writer, dur time.Duration, output fmt.Stringer) *started {
+	wait, err := startCommand(cmd, stdout, stderr)
+	if err != nil {
+		return &started{Err: err}
+	}
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- wait() }()
+
+	var probeErr error
+	if rn.IsProbed() {
+		probeErr = rn.awaitProbed(ctx, waitCh, output)
+		dur = 0
+	}
+
+	select {
+	case err := <-waitCh:
+		return &started{Err: err, ProbeErr: probeErr}
+	case <-ctx.Done():
+		_ = signalProcessGroup(cmd, syscall.SIGKILL)
+		return &started{Err: <-waitCh, ProbeErr: probeErr, Signals: []string{"KILL"}}
+	case <-time.After(dur):
+	}
+
+	signals, err := rn.interrupt(ctx, cmd, waitCh)
+	return &started{Err: err, ProbeErr: probeErr, Signals: signals}
+}
+
+// awaitProbed waits for the started command to be ready and probed, returning
+// the error of becoming ready or of the probes.  The exit of the command is
+// left on waitCh when it exits first.
+func (rn *Runnable) awaitProbed(ctx context.Context, waitCh chan error, output fmt.Stringer) error {
+	probeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	probeCh := make(chan error, 1)
+	go func() { probeCh <- rn.readyAndProbe(probeCtx, output) }()
+
+	select {
+	case probeErr := <-probeCh:
+		return probeErr
+	case err := <-waitCh:
+		waitCh <- err
+	}
+
+	cancel()
+	probeErr := <-probeCh
+
+	// output may have become ready only just before the exit
+	var readyErr *ReadyError
+	if errors.As(probeErr, &readyErr) {
+		if rd, _ := rn.Readiness(); rd != nil && rd.Output != nil && rd.check(ctx, output) {
+			return nil
+		}
+
+		readyErr.Exited = true
+	}
+
+	return probeErr
+}
+
+// interrupt sends the signals of the example's interruption in turn to the
+// process group of the started command until it and the processes it started
+// in the group have exited, and KILL if none of them stopped it, returning the
+// signals that were sent.  Signals are sent after the command has exited as
+// long as its group has not, since background processes of a shell ignore INT.
+func (rn *Runnable) interrupt(ctx context.Context, cmd *exec.Cmd, waitCh chan error) ([]string, error) {
+	intr, err := rn.Interruption()
+	if err != nil {
+		intr = &interruption{Signals: defaultInterruptSignals, Grace: defaultInterruptGrace}
+	}
+
+	sent := []string{}
+	exited := false
+	var waitErr error
+
+	stopped := func() bool {
+		if !exited {
+			select {
+			case waitErr = <-waitCh:
+				exited = true
+			default:
+			}
+		}
+
+		return exited && len(processGroupMembers(cmd.Process.Pid)) == 0
+	}
+
+	kill := func() ([]string, error) {
+		_ = signalProcessGroup(cmd, syscall.SIGKILL)
+		if !exited {
+			waitErr = <-waitCh
+		}
+
+		return append(sent, "KILL"), waitErr
+	}
+
+signals:
+	for _, name := range intr.Signals {
+		if stopped() {
+			return sent, waitErr
+		}
+
+		sig := interruptSignals[name]
+
+		rn.log.WithFields(logrus.Fields{
+			"signal": sig,
+		}).Debug("attempting signal")
+
+		if sigErr := signalProcessGroup(cmd, sig); sigErr != nil {
+			rn.log.WithFields(logrus.Fields{
+				"signal": sig,
+				"err":    sigErr,
+			}).Debug("signal returned error")
+		}
+
+		sent = append(sent, name)
+		graceCh := time.After(intr.Grace)
+
+		for !stopped() {
+			select {
+			case <-ctx.Done():
+				return kill()
+			case <-graceCh:
+				continue signals
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		return sent, waitErr
+	}
+
+	if stopped() {
+		return sent, waitErr
+	}
+
+	return kill()
+}
+
+// runProcessGroup runs the command, which leads a process group of its own,
+// killing the whole group when the context is done before it exits
+func runProcessGroup(ctx context.Context, cmd *exec.Cmd, stdout, stderr io.Writer) error {
+	wait, err := startCommand(cmd, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- wait() }()
+
+	select {
+	case err := <-waitCh:
+		return err
+	case <-ctx.Done():
+		_ = signalProcessGroup(cmd, syscall.SIGKILL)
+		return <-waitCh
+	}
+}
+
+// reapProcessGroup waits up to the outputWaitDelay for the descendants of the
+// exited command to exit, then kills any that remain and reports them
+func (rn *Runnable) reapProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(outputWaitDelay)
+
+	for {
+		pids := processGroupMembers(cmd.Process.Pid)
+		if len(pids) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			rn.log.WithFields(logrus.Fields{
+				"pgid": cmd.Process.Pid,
+				"pids": pids,
+			}).Debug("killing leaked processes")
+
+			_ = signalProcessGroup(cmd, syscall.SIGKILL)
+			return &LeakedProcessesError{Pids: pids}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func runCommand(cmd *exec.Cmd, stdout, stderr io.Writer) error {
+	wait, err := startCommand(cmd, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	return wait()
+}
+
+// startCommand starts the command with its output copied to stdout and stderr
+// and returns a func that waits for it.  Unlike with (*exec.Cmd).Wait, output
+// from descendants that outlive the command is only waited for up to the
+// outputWaitDelay, so that an orphaned process cannot block forever.
+func startCommand(cmd *exec.Cmd, stdout, stderr io.Writer) (func() error, error) {
+	pipes := []*outputPipe{}
+
+	for _, out := range []struct {
+		dest   io.Writer
+		target *io.Writer
+	}{
+		{stdout, &cmd.Stdout},
+		{stderr, &cmd.Stderr},
+	} {
+		if f, ok := out.dest.(*os.File); ok {
+			*out.target = f
+			continue
+		}
+
+		p, err := newOutputPipe(out.dest)
+		if err != nil {
+			for _, p := range pipes {
+				p.abort()
+			}
+			return nil, err
+		}
+
+		*out.target = p.w
+		pipes = append(pipes, p)
+	}
+
+	if err := cmd.Start(); err != nil {
+		for _, p := range pipes {
+			p.abort()
+		}
+		return nil, err
+	}
+
+	for _, p := range pipes {
+		_ = p.w.Close()
+	}
+
+	return func() error {
+		err := cmd.Wait()
+
+		deadline := time.Now().Add(outputWaitDelay)
+		for _, p := range pipes {
+			p.finish(deadline)
+		}
+
+		return err
+	}, nil
+}
+
+// syncBuffer is a buffer that is safe to read while a command writes to it,
+// such as the output of an example that is waited for to be ready
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+type outputPipe struct {
+	r    *os.File
+	w    *os.File
+	done chan struct{}
+}
+
+func newOutputPipe(dest io.Writer) (*outputPipe, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &outputPipe{r: r, w: w, done: make(chan struct{})}
+
+	go func() {
+		_, _ = io.Copy(dest, r)
+		close(p.done)
+	}()
+
+	return p, nil
+}
+
+func (p *outputPipe) finish(deadline time.Time) {
+	select {
+	case <-p.done:
+	case <-time.After(time.Until(deadline)):
+	}
+
+	_ = p.r.Close()
+	<-p.done
+}
+
+func (p *outputPipe) abort() {
+	_ = p.w.Close()
+	_ = p.r.Close()
+	<-p.done
 }
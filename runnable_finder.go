@@ -8,10 +8,27 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// hiddenCommentStart begins a comment whose lines are hidden lines of the
+	// following example
+	hiddenCommentStart = "<!-- gfmrun:hidden"
+
+	// hiddenExamplePlaceholder is the hidden line that is replaced by the
+	// lines of the example
+	hiddenExamplePlaceholder = "gfmrun:example"
+)
+
 var (
 	rawTagsRe = regexp.MustCompile("<!-- *({.+}) *-->")
 
 	codeGateCharsRe = regexp.MustCompile("[`~]+")
+
+	// outputBlockLangs are the info strings of code blocks that are always
+	// treated as the expected output of an adjacent preceding example
+	outputBlockLangs = map[string]bool{
+		"output":         true,
+		"console-output": true,
+	}
 )
 
 type mdState int
@@ -66,6 +83,9 @@ type runnableFinder struct {
 
 	cur *Runnable
 
+	// prev is the last runnable when nothing but blank lines follow it
+	prev *Runnable
+
 	line           string
 	trimmedLine    string
 	lineno         int
@@ -73,6 +93,12 @@ type runnableFinder struct {
 	lastLine       string
 	lastComment    string
 	codeBlockStart string
+
+	// commentLines are the lines of the current comment, and hiddenLines are
+	// the lines of the last "gfmrun:hidden" comment
+	commentLines       []string
+	commentPrevComment string
+	hiddenLines        []string
 }
 
 // custom markdown scanner thingy egad
@@ -85,6 +111,7 @@ func newRunnableFinder(sourceName, source string, log *logrus.Logger) *runnableF
 
 func (rf *runnableFinder) reset() {
 	rf.cur = NewRunnable(rf.sourceName, rf.log)
+	rf.prev = nil
 	rf.state = mdStateText
 	rf.line = ""
 	rf.trimmedLine = ""
@@ -92,6 +119,8 @@ func (rf *runnableFinder) reset() {
 	rf.lineno = 0
 	rf.lastLine = ""
 	rf.lastComment = ""
+	rf.commentLines = nil
+	rf.hiddenLines = nil
 }
 
 func (rf *runnableFinder) Find() []*Runnable {
@@ -106,7 +135,7 @@ func (rf *runnableFinder) Find() []*Runnable {
 
 		runnable := rf.handleLine()
 		if runnable != nil {
-			runnables = append(runnables, runnable)
+			runnables = rf.collect(runnables, runnable)
 			rf.log.WithField("runnable_count", len(runnables)).Debug("leaving runnable code block")
 		}
 
@@ -121,12 +150,67 @@ func (rf *runnableFinder) Find() []*Runnable {
 	if rf.state == mdStateRunnable {
 		// whatever, let's give it a shot
 		rf.cur.Lines = append(rf.cur.Lines, rf.lastLine)
-		runnables = append(runnables, rf.cur)
+		runnables = rf.collect(runnables, rf.cur)
 	}
 
 	return runnables
 }
 
+// collect appends the runnable to the runnables unless it is an output or
+// stdin block adjacent to the previous runnable, in which case it is attached
+// instead, or it continues the group of the previous runnable, in which case
+// it is merged as another file
+func (rf *runnableFinder) collect(runnables []*Runnable, runnable *Runnable) []*Runnable {
+	adjacent := runnable.adjacentTo
+	runnable.adjacentTo = nil
+
+	if group := runnable.Group(); group != "" && len(runnables) > 0 {
+		last := runnables[len(runnables)-1]
+
+		if last.Group() == group {
+			rf.log.WithFields(logrus.Fields{
+				"lineno":        runnable.LineOffset,
+				"runnable_line": last.LineOffset,
+				"group":         group,
+			}).Debug("merging grouped block")
+
+			last.addGroupFile(runnable)
+			rf.prev = last
+			return runnables
+		}
+	}
+
+	if adjacent != nil && adjacent.StdinBlock == nil && runnable.Lang == "stdin" {
+		rf.log.WithFields(logrus.Fields{
+			"lineno":        runnable.LineOffset,
+			"runnable_line": adjacent.LineOffset,
+		}).Debug("attaching stdin block")
+
+		adjacent.StdinBlock = runnable.Lines
+		rf.prev = adjacent
+		return runnables
+	}
+
+	if adjacent != nil && adjacent.OutputBlock == nil {
+		adjacent.parseTags()
+		outputBlockTag, _ := adjacent.Tags["output_block"].(bool)
+
+		if outputBlockLangs[runnable.Lang] || outputBlockTag {
+			rf.log.WithFields(logrus.Fields{
+				"lineno":        runnable.LineOffset,
+				"runnable_line": adjacent.LineOffset,
+			}).Debug("attaching output block")
+
+			adjacent.OutputBlock = runnable.Lines
+			adjacent.OutputBlockLineOffset = runnable.LineOffset
+			rf.prev = adjacent
+			return runnables
+		}
+	}
+
+	return append(runnables, runnable)
+}
+
 func (rf *runnableFinder) handleLine() *Runnable {
 	if strings.HasPrefix(rf.trimmedLine, "```") || strings.HasPrefix(rf.trimmedLine, "~~~") {
 		if rf.state == mdStateCodeBlock {
@@ -216,11 +300,25 @@ func (rf *runnableFinder) handleTransition(transition int) *Runnable {
 	case mdStateTransTextCodeBlock:
 		rf.codeBlockStart = rf.trimmedLine
 		rf.textSize = 0
+		rf.prev = nil
+		rf.hiddenLines = nil
 	case mdStateTransTextComment:
 		rf.textSize = 0
+		rf.commentPrevComment = rf.lastComment
+		rf.commentLines = []string{rf.line}
 		rf.lastComment = rf.line
+		rf.prev = nil
 	case mdStateTransCommentText:
 		rf.textSize = len(rf.trimmedLine)
+
+		// a hidden comment does not replace the tags comment before it
+		if len(rf.commentLines) > 0 && strings.HasPrefix(strings.TrimSpace(rf.commentLines[0]), hiddenCommentStart) {
+			rf.log.WithField("lineno", rf.lineno).Debug("setting hidden lines")
+			rf.hiddenLines = rf.commentLines[1:]
+			rf.lastComment = rf.commentPrevComment
+		}
+
+		rf.commentLines = nil
 	case mdStateTransCodeBlockText:
 		rf.codeBlockStart = ""
 		rf.log.Debug("leaving non-runnable code block")
@@ -228,6 +326,8 @@ func (rf *runnableFinder) handleTransition(transition int) *Runnable {
 		runnable := rf.cur
 		rf.cur = NewRunnable(rf.sourceName, rf.log)
 		rf.lastComment = ""
+		rf.textSize = 0
+		rf.prev = runnable
 		return runnable
 	case mdStateTransTextCodeBlock:
 		rf.log.WithField("lineno", rf.lineno).Debug("starting new non-runnable code block")
@@ -248,6 +348,17 @@ func (rf *runnableFinder) handleTransition(transition int) *Runnable {
 			}
 		}
 
+		if rf.textSize == 0 {
+			rf.cur.HiddenLines = rf.hiddenLines
+		}
+
+		if rf.prev != nil && rf.textSize == 0 {
+			rf.cur.adjacentTo = rf.prev
+		}
+
+		rf.hiddenLines = nil
+
+		rf.prev = nil
 		rf.lastComment = ""
 		rf.cur.Begin(rf.lineno, rf.trimmedLine)
 	case mdStateTransRunnableComment, mdStateTransCommentCodeBlock:
@@ -262,9 +373,14 @@ func (rf *runnableFinder) handleLineInState() {
 	switch rf.state {
 	case mdStateComment:
 		rf.lastComment += rf.line
+		rf.commentLines = append(rf.commentLines, rf.line)
 	case mdStateRunnable:
 		rf.cur.Lines = append(rf.cur.Lines, rf.line)
 	case mdStateText:
 		rf.textSize += len(rf.trimmedLine)
+		if rf.textSize > 0 {
+			rf.prev = nil
+			rf.hiddenLines = nil
+		}
 	}
 }
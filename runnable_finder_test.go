@@ -0,0 +1,143 @@
+package gfmrun
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunnableFinder_FindOutputBlocks(t *testing.T) {
+	source := strings.Join([]string{
+		"``` sh",
+		"echo one",
+		"```",
+		"",
+		"``` output",
+		"one",
+		"```",
+		"",
+		"``` sh",
+		"echo two",
+		"```",
+		"",
+		"which prints:",
+		"",
+		"``` output",
+		"two",
+		"```",
+		"",
+		`<!-- { "output_block": true } -->`,
+		"``` sh",
+		"echo three",
+		"```",
+		"``` text",
+		"three",
+		"```",
+	}, "\n")
+
+	runnables := newRunnableFinder("README.md", source, testLog).Find()
+	assert.Len(t, runnables, 4)
+
+	assert.Equal(t, "sh", runnables[0].Lang)
+	assert.Equal(t, []string{"one"}, runnables[0].OutputBlock)
+	assert.Equal(t, 5, runnables[0].OutputBlockLineOffset)
+
+	assert.Equal(t, "sh", runnables[1].Lang)
+	assert.Nil(t, runnables[1].OutputBlock)
+	assert.Equal(t, "output", runnables[2].Lang)
+
+	assert.Equal(t, "sh", runnables[3].Lang)
+	assert.Equal(t, []string{"three"}, runnables[3].OutputBlock)
+}
+
+func TestRunnableFinder_FindStdinBlocks(t *testing.T) {
+	source := strings.Join([]string{
+		"``` sh",
+		"read name",
+		`echo "hello $name"`,
+		"```",
+		"``` stdin",
+		"gopher",
+		"```",
+		"``` output",
+		"hello gopher",
+		"```",
+	}, "\n")
+
+	runnables := newRunnableFinder("README.md", source, testLog).Find()
+	assert.Len(t, runnables, 1)
+	assert.Equal(t, []string{"gopher"}, runnables[0].StdinBlock)
+	assert.Equal(t, []string{"hello gopher"}, runnables[0].OutputBlock)
+}
+
+func TestRunnableFinder_FindGroupedBlocks(t *testing.T) {
+	source := strings.Join([]string{
+		`<!-- { "group": "greeter", "file": "main.go", "output": "hello" } -->`,
+		"``` go",
+		"package main",
+		"",
+		"func main() { greet() }",
+		"```",
+		"",
+		`<!-- { "group": "greeter", "file": "greet.go", "args": ["x"] } -->`,
+		"``` go",
+		"package main",
+		"",
+		`func greet() { println("hello") }`,
+		"```",
+		"``` output",
+		"hello",
+		"```",
+		"",
+		`<!-- { "group": "other" } -->`,
+		"``` go",
+		"package main",
+		"```",
+	}, "\n")
+
+	runnables := newRunnableFinder("README.md", source, testLog).Find()
+	assert.Len(t, runnables, 2)
+	assert.Len(t, runnables[0].GroupFiles, 1)
+	assert.Equal(t, 9, runnables[0].GroupFiles[0].LineOffset)
+	assert.Equal(t, []string{"x"}, runnables[0].Args())
+	assert.Equal(t, "main.go", runnables[0].Tags["file"])
+	assert.Equal(t, []string{"hello"}, runnables[0].OutputBlock)
+	assert.Equal(t, "other", runnables[1].Group())
+}
+
+func TestRunnableFinder_FindHiddenLines(t *testing.T) {
+	source := strings.Join([]string{
+		`<!-- { "output": "3" } -->`,
+		"<!-- gfmrun:hidden",
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		"func main() {",
+		"gfmrun:example",
+		"}",
+		"-->",
+		"``` go",
+		"fmt.Println(1 + 2)",
+		"```",
+		"",
+		"<!-- gfmrun:hidden",
+		"echo setup",
+		"-->",
+		"",
+		"Some text in between.",
+		"",
+		"``` sh",
+		"echo visible",
+		"```",
+	}, "\n")
+
+	runnables := newRunnableFinder("README.md", source, testLog).Find()
+	assert.Len(t, runnables, 2)
+	assert.Equal(t, "3", runnables[0].ExpectedOutput().String())
+	assert.Equal(t, []string{"fmt.Println(1 + 2)"}, runnables[0].Lines)
+	assert.Equal(t, "package main\n\nimport \"fmt\"\n\nfunc main() {\nfmt.Println(1 + 2)\n}", runnables[0].String())
+	assert.Nil(t, runnables[1].HiddenLines)
+	assert.Equal(t, "echo visible", runnables[1].String())
+}
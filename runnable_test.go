@@ -0,0 +1,58 @@
+package gfmrun
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTaggedRunnable(rawTags string) *Runnable {
+	rn := NewRunnable("EXAMPLES.md", testLog)
+	rn.RawTags = rawTags
+	return rn
+}
+
+func TestRunnable_Interruption(t *testing.T) {
+	for _, tc := range []struct {
+		rawTags  string
+		expected *interruption
+	}{
+		{
+			rawTags:  `{}`,
+			expected: &interruption{After: defaultKillDuration, Signals: defaultInterruptSignals, Grace: defaultInterruptGrace},
+		},
+		{
+			rawTags:  `{ "interrupt": "2s" }`,
+			expected: &interruption{After: 2 * time.Second, Signals: defaultInterruptSignals, Grace: defaultInterruptGrace},
+		},
+		{
+			rawTags:  `{ "interrupt": { "after": "200ms", "signals": ["term", "SIGINT"], "grace": "1s", "expect_clean_exit": true } }`,
+			expected: &interruption{After: 200 * time.Millisecond, Signals: []string{"TERM", "INT"}, Grace: time.Second, ExpectCleanExit: true},
+		},
+	} {
+		intr, err := newTaggedRunnable(tc.rawTags).Interruption()
+		assert.Nil(t, err, tc.rawTags)
+		assert.Equal(t, tc.expected, intr, tc.rawTags)
+	}
+
+	for _, rawTags := range []string{
+		`{ "interrupt": { "signals": ["NOPE"] } }`,
+		`{ "interrupt": { "after": "soon" } }`,
+		`{ "interrupt": { "grace": "a while" } }`,
+	} {
+		rn := newTaggedRunnable(rawTags)
+
+		_, err := rn.Interruption()
+		assert.NotNil(t, err, rawTags)
+
+		interruptable, dur := rn.Interruptable()
+		assert.True(t, interruptable, rawTags)
+		assert.Equal(t, defaultKillDuration, dur, rawTags)
+	}
+}
+
+func TestRunnable_Env(t *testing.T) {
+	rn := newTaggedRunnable(`{ "env": { "NAME": "gopher", "COUNT": 1000000, "RATIO": 0.25, "DEBUG": true } }`)
+	assert.Equal(t, []string{"COUNT=1000000", "DEBUG=true", "NAME=gopher", "RATIO=0.25"}, rn.Env())
+}
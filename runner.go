@@ -1,8 +1,12 @@
 package gfmrun
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -15,9 +19,61 @@ type Runner struct {
 	Frobs     map[string]Frob
 	Languages *Languages
 
-	noExec     bool
-	extractDir string
-	log        *logrus.Logger
+	// Concurrency is the maximum number of examples from a single source that
+	// are run at the same time.  Values less than 1 are treated as 1.
+	Concurrency int
+
+	// Timeout is the maximum duration of each example that does not have a
+	// "timeout" tag of its own.  A zero value means there is no limit.
+	Timeout time.Duration
+
+	// JUnitReport is the path of a JUnit XML report to write after running,
+	// with one testsuite per source and one testcase per example
+	JUnitReport string
+
+	// JSONEvents, when non-nil, receives a line-delimited stream of JSON
+	// events compatible with `go test -json` tooling
+	JSONEvents io.Writer
+
+	// UpdateGolden rewrites the golden files of examples with an
+	// "output_file" tag from their actual output instead of comparing them
+	UpdateGolden bool
+
+	// CleanEnv runs examples with only a minimal allowlisted environment
+	// (such as PATH, HOME, TMPDIR, and the Go caches) instead of the full
+	// environment of the current process
+	CleanEnv bool
+
+	// GoWrap checks Go examples that are not a main package by default, as
+	// if they had a "wrap" tag, wrapping snippets in a main func and type
+	// checking other packages
+	GoWrap bool
+
+	// ShellSessions runs console transcripts by default, as if they had a
+	// "shell_session" tag
+	ShellSessions bool
+
+	// GoReplace are "module=path" replace directives added to the go.mod of
+	// Go examples, in addition to one for the module enclosing each source
+	GoReplace []string
+
+	// GoFlags are flags given to the go tool when building or checking every
+	// Go example, such as "-race" or "-tags=integration"
+	GoFlags []string
+
+	// GoIsolate builds every Go example as a module of its own instead of
+	// sharing a module with the other Go examples of the same source
+	GoIsolate bool
+
+	// NoCache runs every example instead of reusing the results of examples
+	// that passed before and have not changed since
+	NoCache bool
+
+	noExec      bool
+	extractDir  string
+	cacheDir    string
+	goTimeSaved time.Duration
+	log         *logrus.Logger
 }
 
 // NewRunner makes a *Runner from a slice of sources, optional expected example
@@ -58,30 +114,76 @@ func NewRunner(sources []string, count int, languagesYml string, autoPull bool,
 		Frobs:     DefaultFrobs,
 		Languages: langs,
 
-		log: log,
+		Concurrency: 1,
+
+		cacheDir: filepath.Join(getCacheDir(), "results"),
+		log:      log,
 	}, nil
 }
 
 // Run scans all sources for runnable examples, runs them, and returns a slice
 // of errors encountered
 func (r *Runner) Run() []error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops running examples when the context is done
+func (r *Runner) RunContext(ctx context.Context) []error {
+	return r.RunReportContext(ctx).Errors
+}
+
+// RunReport scans all sources for runnable examples, runs them, and returns a
+// report including the result of every example
+func (r *Runner) RunReport() *Report {
+	return r.RunReportContext(context.Background())
+}
+
+// RunReportContext is like RunReport, but stops running examples when the
+// context is done
+func (r *Runner) RunReportContext(ctx context.Context) *Report {
+	rep := &Report{Results: []*Result{}}
+
 	if len(r.Sources) < 1 {
 		r.log.Warn("no sources given")
-		return nil
+		return rep
 	}
 
-	res := []*runResult{}
+	res := []*Result{}
+	suites := []*junitTestSuite{}
 
 	sourcesStart := time.Now()
+	r.goTimeSaved = 0
 
 	for i, sourceFile := range r.Sources {
+		sourceStart := time.Now()
+
 		sourceBytes, err := os.ReadFile(sourceFile)
 		if err != nil {
-			res = append(res, &runResult{Retcode: -1, Error: err})
+			res = append(res, (&Result{Runnable: NewRunnable(sourceFile, r.log), Retcode: -1, Error: err}).finalize())
+			suites = append(suites, newJUnitTestSuite(sourceFile, sourceStart, time.Since(sourceStart), nil, err))
 			continue
 		}
 
-		res = append(res, r.checkSource(i, sourceFile, string(sourceBytes))...)
+		sourceRes := r.checkSource(ctx, i, sourceFile, string(sourceBytes))
+		res = append(res, sourceRes...)
+		suites = append(suites, newJUnitTestSuite(sourceFile, sourceStart, time.Since(sourceStart), sourceRes, nil))
+	}
+
+	rep.Results = res
+	rep.Duration = time.Since(sourcesStart)
+
+	if !r.noExec && r.JUnitReport != "" {
+		if err := writeJUnitReport(r.JUnitReport, suites); err != nil {
+			r.log.WithFields(logrus.Fields{
+				"path": r.JUnitReport,
+				"err":  err,
+			}).Error("failed to write junit report")
+
+			rep.Errors = []error{err}
+			return rep
+		}
+
+		r.log.WithField("path", r.JUnitReport).Info("wrote junit report")
 	}
 
 	if !r.noExec && r.Count > 0 && len(res) != r.Count {
@@ -90,11 +192,13 @@ func (r *Runner) Run() []error {
 			"actual":   len(res),
 		}).Error("mismatched example count")
 
-		return []error{fmt.Errorf("example count %d != expected %d", len(res), r.Count)}
+		rep.Errors = []error{fmt.Errorf("example count %d != expected %d", len(res), r.Count)}
+		return rep
 	}
 
 	if len(res) == 0 {
-		return []error{}
+		rep.Errors = []error{}
+		return rep
 	}
 
 	errs := []error{}
@@ -113,12 +217,21 @@ func (r *Runner) Run() []error {
 		}
 
 		if result.Error != nil {
-			if v, ok := result.Error.(*skipErr); ok {
+			if v, ok := result.Error.(*SkipError); ok {
 				r.log.WithFields(logrus.Fields{
 					"source": result.Runnable.SourceFile,
 					"line":   result.Runnable.LineOffset,
 					"reason": v.Reason,
 				}).Debug("skipped example")
+			} else if v, ok := result.Error.(*TimeoutError); ok {
+				r.log.WithFields(logrus.Fields{
+					"source":  result.Runnable.SourceFile,
+					"line":    result.Runnable.LineOffset,
+					"timeout": v.Timeout,
+				}).Warn("timed out example")
+
+				errs = append(errs, fmt.Errorf("%s:%d: %w",
+					result.Runnable.SourceFile, result.Runnable.LineOffset, v))
 			} else {
 				errs = append(errs, result.Error)
 			}
@@ -129,43 +242,259 @@ func (r *Runner) Run() []error {
 		"source_count":  len(r.Sources),
 		"example_count": len(res),
 		"error_count":   len(errs),
-		"time":          time.Since(sourcesStart),
+		"time":          rep.Duration,
+		"go_time_saved": r.goTimeSaved,
 	}).Info("done")
 
-	return errs
+	rep.Errors = errs
+	return rep
 }
 
-func (r *Runner) checkSource(i int, sourceName, source string) []*runResult {
-	res := []*runResult{}
+func (r *Runner) checkSource(ctx context.Context, i int, sourceName, source string) []*Result {
+	res := []*Result{}
 	sourceStart := time.Now()
 	runnables := r.findRunnables(i, sourceName, source)
 
-	for j, runnable := range runnables {
-		if r.noExec {
+	if r.noExec {
+		for j, runnable := range runnables {
 			res = append(res, runnable.Extract(j, r.extractDir))
+		}
+
+		return res
+	}
+
+	jobs := r.Concurrency
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	events := newEventEmitter(r.JSONEvents)
+	events.SourceStart(sourceName)
+
+	cacheKeys := make([]string, len(runnables))
+	cached := make([]*cachedResult, len(runnables))
+	uncached := []*Runnable{}
+
+	var cache *resultCache
+	if !r.NoCache && !r.UpdateGolden {
+		cache = newResultCache(r.cacheDir)
+	}
+
+	for j, runnable := range runnables {
+		// services, the examples that need them, and examples of a session
+		// depend on more than their own content, so they are always run
+		if cache != nil && runnable.ServiceName() == "" && len(runnable.Needs()) == 0 && runnable.SessionName() == "" {
+			key, err := cache.Key(runnable)
+			if err != nil {
+				r.log.WithFields(logrus.Fields{
+					"source": sourceName,
+					"line":   runnable.LineOffset,
+					"err":    err,
+				}).Debug("failed to compute cache key")
+			} else {
+				cacheKeys[j] = key
+				cached[j] = cache.Get(key)
+			}
+		}
+
+		if cached[j] == nil {
+			uncached = append(uncached, runnable)
+		}
+	}
+
+	if !r.GoIsolate {
+		env := os.Environ()
+		if r.CleanEnv {
+			env = cleanEnviron(env)
+		}
+
+		ws := newGoWorkspace(ctx, sourceName, uncached, r.GoReplace, env, r.log)
+		defer ws.Remove()
+
+		for _, runnable := range runnables {
+			runnable.goWorkspace = ws
+		}
+
+		r.goTimeSaved += ws.TimeSaved()
+	}
+
+	sessions := map[string]*session{}
+	sessionErrs := make([]error, len(runnables))
+
+	for j, runnable := range runnables {
+		name := runnable.SessionName()
+		if name == "" {
 			continue
 		}
 
+		if _, ok := sessions[name]; !ok {
+			sess, err := newSession(name)
+			if err != nil {
+				sessionErrs[j] = err
+				continue
+			}
+
+			sessions[name] = sess
+			defer sess.Remove()
+		}
+
+		runnable.session = sessions[name]
+	}
+
+	// the tags of examples are only read before any of them run, as running
+	// an example parses its tags again
+	serviceNames := make([]string, len(runnables))
+	for j, runnable := range runnables {
+		serviceNames[j] = runnable.ServiceName()
+	}
+
+	needed, neededErrs := neededServices(runnables, serviceNames)
+
+	res = make([]*Result, len(runnables))
+	done := make([]chan struct{}, len(runnables))
+	outBufs := make([]*bytes.Buffer, len(runnables))
+	errBufs := make([]*bytes.Buffer, len(runnables))
+
+	for j, runnable := range runnables {
+		done[j] = make(chan struct{})
+
+		// output from non-Main commands is held back when running
+		// concurrently so that it is not interleaved between examples, and
+		// when emitting events so that it does not corrupt the event stream
+		if jobs > 1 || events != nil {
+			outBufs[j] = &bytes.Buffer{}
+			errBufs[j] = &bytes.Buffer{}
+			runnable.stdout = outBufs[j]
+			runnable.stderr = errBufs[j]
+		}
+	}
+
+	go func() {
+		sem := make(chan struct{}, jobs)
+
+		for j, runnable := range runnables {
+			sem <- struct{}{}
+
+			go func(j int, runnable *Runnable) {
+				defer func() {
+					<-sem
+					close(done[j])
+				}()
+
+				if cached[j] != nil {
+					res[j] = (&Result{
+						Runnable: runnable,
+						Stdout:   cached[j].Stdout,
+						Stderr:   cached[j].Stderr,
+						Cached:   true,
+					}).finalize()
+					return
+				}
+
+				if err := sessionErrs[j]; err != nil {
+					res[j] = (&Result{Runnable: runnable, Retcode: -1, Error: err}).finalize()
+					return
+				}
+
+				if err := awaitSession(runnables, done, j); err != nil {
+					res[j] = (&Result{Runnable: runnable, Retcode: -1, Error: err}).finalize()
+					return
+				}
+
+				if err := neededErrs[j]; err != nil {
+					res[j] = (&Result{Runnable: runnable, Retcode: -1, Error: err}).finalize()
+					return
+				}
+
+				if err := awaitServices(runnables, serviceNames, res, done, needed[j]); err != nil {
+					res[j] = (&Result{Runnable: runnable, Retcode: -1, Error: err}).finalize()
+					return
+				}
+
+				// the start of each example is logged in source order below,
+				// as examples may start in any order when run concurrently
+				r.log.WithFields(logrus.Fields{
+					"i":      fmt.Sprintf("%d/%d", j+1, len(runnables)),
+					"source": sourceName,
+					"line":   runnable.LineOffset,
+				}).Debug("running")
+
+				start := time.Now()
+				res[j] = runnable.RunContext(ctx, j)
+				res[j].Duration = time.Since(start)
+
+				if runnable.session != nil && res[j].Status == StatusFail && runnable.session.FailedLine == 0 {
+					runnable.session.FailedLine = runnable.LineOffset
+				}
+
+				if cacheKeys[j] != "" && res[j].Status == StatusPass {
+					if err := cache.Put(cacheKeys[j], res[j]); err != nil {
+						r.log.WithFields(logrus.Fields{
+							"source": sourceName,
+							"line":   runnable.LineOffset,
+							"err":    err,
+						}).Debug("failed to cache result")
+					}
+				}
+			}(j, runnable)
+		}
+	}()
+
+	for j, runnable := range runnables {
 		r.log.WithFields(logrus.Fields{
 			"i":      fmt.Sprintf("%d/%d", j+1, len(runnables)),
 			"source": sourceName,
 			"line":   runnable.LineOffset,
 			"lang":   runnable.Lang,
 		}).Info("start")
+		events.RunnableStart(runnable)
 
-		start := time.Now()
-		res = append(res, runnable.Run(j))
-		end := time.Since(start)
+		<-done[j]
+
+		if events != nil {
+			events.RunnableOutput(runnable, outBufs[j].String())
+			events.RunnableOutput(runnable, errBufs[j].String())
+		} else if outBufs[j] != nil {
+			_, _ = os.Stdout.Write(outBufs[j].Bytes())
+			_, _ = os.Stderr.Write(errBufs[j].Bytes())
+		}
+
+		var elapsed interface{} = res[j].Duration
+		if res[j].Cached {
+			elapsed = "(cached)"
+		}
 
 		r.log.WithFields(logrus.Fields{
 			"i":      fmt.Sprintf("%d/%d", j+1, len(runnables)),
 			"source": sourceName,
 			"line":   runnable.LineOffset,
 			"lang":   runnable.Lang,
-			"time":   end,
+			"time":   elapsed,
 		}).Info("finish")
+		events.RunnableFinish(res[j])
 	}
 
+	// services are stopped in the reverse of the order they were started in,
+	// since later services may need earlier ones, and fail when they did not
+	// keep running until then or did not stop cleanly
+	for j := len(runnables) - 1; j >= 0; j-- {
+		if err := runnables[j].stopService(ctx); err != nil {
+			r.log.WithFields(logrus.Fields{
+				"source":  sourceName,
+				"line":    runnables[j].LineOffset,
+				"service": serviceNames[j],
+				"err":     err,
+			}).Error("service did not stop cleanly")
+
+			if res[j].Error == nil {
+				res[j].Error = err
+				res[j].finalize()
+			}
+		}
+	}
+
+	events.SourceFinish(sourceName, res, time.Since(sourceStart))
+
 	r.log.WithFields(logrus.Fields{
 		"source": sourceName,
 		"time":   time.Since(sourceStart),
@@ -174,6 +503,68 @@ func (r *Runner) checkSource(i int, sourceName, source string) []*runResult {
 	return res
 }
 
+// awaitSession waits for the example before the j-th runnable in its session,
+// if any, and returns a SkipError when an earlier example of the session failed
+func awaitSession(runnables []*Runnable, done []chan struct{}, j int) error {
+	sess := runnables[j].session
+	if sess == nil {
+		return nil
+	}
+
+	for k := j - 1; k >= 0; k-- {
+		if runnables[k].session == sess {
+			<-done[k]
+			break
+		}
+	}
+
+	if sess.FailedLine != 0 {
+		return &SkipError{Reason: fmt.Sprintf("session %q failed at line %d", sess.Name, sess.FailedLine)}
+	}
+
+	return nil
+}
+
+// neededServices returns the indexes of the services of the "needs" tag of
+// each runnable, which are the closest preceding examples with those
+// "service" names, or an error when there is no such example
+func neededServices(runnables []*Runnable, serviceNames []string) ([][]int, []error) {
+	needed := make([][]int, len(runnables))
+	errs := make([]error, len(runnables))
+
+	for j, runnable := range runnables {
+		for _, name := range runnable.Needs() {
+			k := j - 1
+			for k >= 0 && serviceNames[k] != name {
+				k--
+			}
+
+			if k < 0 {
+				errs[j] = fmt.Errorf("needs service %q, which is not an earlier example in the source", name)
+				break
+			}
+
+			needed[j] = append(needed[j], k)
+		}
+	}
+
+	return needed, errs
+}
+
+// awaitServices waits for the needed services and returns a SkipError when one
+// of them is not running
+func awaitServices(runnables []*Runnable, serviceNames []string, res []*Result, done []chan struct{}, needed []int) error {
+	for _, k := range needed {
+		<-done[k]
+
+		if res[k].Status != StatusPass || runnables[k].service == nil {
+			return &SkipError{Reason: fmt.Sprintf("service %q is not running", serviceNames[k])}
+		}
+	}
+
+	return nil
+}
+
 func (r *Runner) findRunnables(i int, sourceName, source string) []*Runnable {
 	finder := newRunnableFinder(sourceName, source, r.log)
 	runnables := finder.Find()
@@ -207,6 +598,13 @@ func (r *Runner) findRunnables(i int, sourceName, source string) []*Runnable {
 		}
 
 		runnable.Frob = exe
+		runnable.defaultTimeout = r.Timeout
+		runnable.defaultWrap = r.GoWrap
+		runnable.shellSessions = r.ShellSessions
+		runnable.goReplace = r.GoReplace
+		runnable.goFlags = r.GoFlags
+		runnable.updateGolden = r.UpdateGolden
+		runnable.cleanEnv = r.CleanEnv
 
 		if err := exe.CanExecute(runnable); err != nil {
 			r.log.WithFields(logrus.Fields{
@@ -1,7 +1,16 @@
 package gfmrun
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,3 +27,974 @@ func TestNewRunnerIntegration(t *testing.T) {
 	assert.NotNil(t, runner.Frobs)
 	assert.Equal(t, 0, runner.Count)
 }
+
+func TestRunner_RunConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 3, []string{
+		`<!-- { "output": "^one\n$" } -->`,
+		"``` sh",
+		"echo one",
+		"```",
+		"",
+		`<!-- { "output": "^two\n$" } -->`,
+		"``` sh",
+		"echo two",
+		"```",
+		"",
+		"``` sh",
+		"exit 86",
+		"```",
+	})
+
+	runner.Concurrency = 3
+
+	errs := runner.Run()
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "exit status 86")
+}
+
+func TestRunner_RunContextTimeout(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "timeout": "100ms" } -->`,
+		"``` sh",
+		"sleep 5",
+		"```",
+	})
+
+	start := time.Now()
+	errs := runner.RunContext(context.Background())
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "timed out after 100ms")
+}
+
+func TestRunner_RunReport(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 0, []string{
+		"``` sh",
+		"echo ok",
+		"```",
+		"",
+		`<!-- { "output": "nope" } -->`,
+		"``` sh",
+		"echo yep",
+		"```",
+		"",
+		"``` sh",
+		"exit 3",
+		"```",
+		"",
+		`<!-- { "os": "plan9" } -->`,
+		"``` sh",
+		"exit 1",
+		"```",
+	})
+
+	rep := runner.RunReport()
+	assert.Len(t, rep.Results, 4)
+	assert.Len(t, rep.Failed(), 2)
+	assert.Len(t, rep.Skipped(), 1)
+	assert.NotNil(t, rep.Err())
+
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+	assert.Equal(t, "ok\n", rep.Results[0].Stdout)
+
+	mismatchErr := &OutputMismatchError{}
+	assert.True(t, errors.As(rep.Results[1].Error, &mismatchErr))
+	assert.Equal(t, "stdout", mismatchErr.Stream)
+	assert.Equal(t, "yep\n", mismatchErr.Actual)
+
+	exitErr := &ExitError{}
+	assert.True(t, errors.As(rep.Results[2].Error, &exitErr))
+	assert.Equal(t, 3, exitErr.Retcode)
+	assert.Equal(t, 3, rep.Results[2].Retcode)
+
+	skipErr := &SkipError{}
+	assert.True(t, errors.As(rep.Results[3].Error, &skipErr))
+	assert.Equal(t, "os not supported", rep.Results[3].SkipReason)
+	assert.Equal(t, "plan9", rep.Results[3].Tags["os"])
+}
+
+func TestRunner_RunGoldenFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+	golden := filepath.Join(dir, "testdata", "hello.txt")
+
+	runner := newTestRunner(t, source, 0, []string{
+		`<!-- { "output_file": "testdata/hello.txt" } -->`,
+		"``` sh",
+		"printf 'hello\\nthere\\n'",
+		"```",
+		"",
+		`<!-- { "output_exact": "hello\nthere\n" } -->`,
+		"``` sh",
+		"printf 'hello\\nthere\\n'",
+		"```",
+	})
+
+	runner.UpdateGolden = true
+	assert.Empty(t, runner.Run())
+
+	goldenBytes, err := os.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\nthere\n", string(goldenBytes))
+
+	runner.UpdateGolden = false
+	assert.Empty(t, runner.Run())
+
+	assert.Nil(t, os.WriteFile(golden, []byte("hello\nwhere\n"), 0600))
+
+	rep := runner.RunReport()
+	assert.Len(t, rep.Failed(), 1)
+
+	mismatchErr := &OutputMismatchError{}
+	assert.True(t, errors.As(rep.Results[0].Error, &mismatchErr))
+	assert.Equal(t, golden, mismatchErr.Source)
+	assert.Contains(t, mismatchErr.Diff, "-where\n+there\n")
+}
+
+func TestRunner_RunGoldenFileFailed(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+	golden := filepath.Join(dir, "testdata", "crashed.txt")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "output_file": "testdata/crashed.txt" } -->`,
+		"``` sh",
+		"echo partial",
+		"exit 1",
+		"```",
+	})
+
+	runner.UpdateGolden = true
+	assert.Len(t, runner.Run(), 1)
+
+	_, err := os.Stat(golden)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunner_RunShellSession(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 0, []string{
+		"``` console",
+		"$ export GREETING=hello",
+		"$ echo \"$GREETING\"",
+		"hello",
+		"$ cat <<EOF",
+		"> > quoted",
+		"> EOF",
+		"> quoted",
+		"$ echo nope",
+		"yep",
+		"```",
+		"",
+		`<!-- { "shell_session": false } -->`,
+		"``` console",
+		"$ echo skipped",
+		"```",
+	})
+
+	rep := runner.RunReport()
+	assert.Len(t, rep.Results, 0)
+
+	runner.ShellSessions = true
+
+	rep = runner.RunReport()
+	assert.Len(t, rep.Results, 1)
+	assert.Len(t, rep.Failed(), 1)
+	assert.Equal(t, "hello\n> quoted\nnope\n", rep.Results[0].Stdout)
+
+	mismatchErr := &OutputMismatchError{}
+	assert.True(t, errors.As(rep.Results[0].Error, &mismatchErr))
+	assert.Equal(t, source+":9 (echo nope)", mismatchErr.Source)
+	assert.Equal(t, "yep", mismatchErr.Expected)
+	assert.Equal(t, "nope", mismatchErr.Actual)
+}
+
+func TestRunner_RunExitCode(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 6, []string{
+		`<!-- { "exit_code": 3 } -->`,
+		"``` sh",
+		"exit 3",
+		"```",
+		"",
+		`<!-- { "exit_code": [0, 1] } -->`,
+		"``` sh",
+		"exit 2",
+		"```",
+		"",
+		`<!-- { "exit_code": 3, "error": "oops" } -->`,
+		"``` sh",
+		"echo oops >&2",
+		"```",
+		"",
+		`<!-- { "exit_code": 3, "error": "oops" } -->`,
+		"``` sh",
+		"echo fine >&2",
+		"exit 3",
+		"```",
+		"",
+		`<!-- { "exit_code": [] } -->`,
+		"``` sh",
+		"exit 0",
+		"```",
+		"",
+		`<!-- { "exit_code": ["3"] } -->`,
+		"``` sh",
+		"exit 3",
+		"```",
+	})
+
+	rep := runner.RunReport()
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+	assert.Equal(t, 3, rep.Results[0].Retcode)
+
+	exitErr := &ExitError{}
+	assert.True(t, errors.As(rep.Results[1].Error, &exitErr))
+	assert.Equal(t, 2, exitErr.Retcode)
+	assert.Equal(t, "exit status 2, expected one of [0 1]", exitErr.Error())
+
+	assert.True(t, errors.As(rep.Results[2].Error, &exitErr))
+	assert.Equal(t, 0, exitErr.Retcode)
+	assert.Equal(t, "exit status 0, expected 3", exitErr.Error())
+
+	mismatchErr := &OutputMismatchError{}
+	assert.True(t, errors.As(rep.Results[3].Error, &mismatchErr))
+	assert.Equal(t, "stderr", mismatchErr.Stream)
+	assert.Equal(t, 3, rep.Results[3].Retcode)
+
+	assert.Equal(t, StatusPass, rep.Results[4].Status)
+
+	assert.True(t, errors.As(rep.Results[5].Error, &exitErr))
+	assert.Equal(t, "exit status 3", exitErr.Error())
+
+	assert.Equal(t, "exit status 0", (&ExitError{Expected: []int{}}).Error())
+}
+
+func TestRunner_RunStdin(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 2, []string{
+		`<!-- { "stdin": "gopher\n", "output_exact": "hello gopher\n" } -->`,
+		"``` sh",
+		"read name",
+		`echo "hello $name"`,
+		"```",
+		"",
+		`<!-- { "stdin_file": "testdata/name.txt", "output_exact": "hello file\n" } -->`,
+		"``` sh",
+		"read name",
+		`echo "hello $name"`,
+		"```",
+	})
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "testdata"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "testdata", "name.txt"), []byte("file\n"), 0600))
+
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunCleanEnv(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	t.Setenv("GFMRUN_TEST_LEAKY", "leaked")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "env": { "GREETING": "ohai", "COUNT": 3 }, "output_exact": "ohai 3 clean\n" } -->`,
+		"``` sh",
+		`echo "$GREETING $COUNT ${GFMRUN_TEST_LEAKY:-clean}"`,
+		"```",
+	})
+
+	runner.CleanEnv = true
+	assert.Empty(t, runner.Run())
+
+	runner.CleanEnv = false
+	assert.Len(t, runner.Run(), 1)
+}
+
+func TestRunner_RunFixtures(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "repo", "docs", "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 4, []string{
+		`<!-- { "files": { "config/app.ini": "name=gopher\n", "data": { "path": "../testdata" } }, "output_exact": "name=gopher\nfixture\n" } -->`,
+		"``` sh",
+		"cat config/app.ini",
+		"cat data/nested/fixture.txt",
+		"```",
+		"",
+		`<!-- { "files": { "../escape.txt": "nope" } } -->`,
+		"``` sh",
+		"true",
+		"```",
+		"",
+		`<!-- { "files": { "passwd": { "path": "/etc/passwd" } } } -->`,
+		"``` sh",
+		"true",
+		"```",
+		"",
+		`<!-- { "files": { "secret.txt": { "path": "../testdata/../../secret.txt" } } } -->`,
+		"``` sh",
+		"true",
+		"```",
+	})
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "repo", ".git"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "repo", "testdata", "nested"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "repo", "testdata", "nested", "fixture.txt"), []byte("fixture\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret\n"), 0600))
+
+	rep := runner.RunReport()
+	assert.Len(t, rep.Errors, 3)
+	assert.Equal(t, StatusPass, rep.Results[0].Status, fmt.Sprintf("%v", rep.Results[0].Error))
+	assert.Contains(t, rep.Results[1].Error.Error(), "../escape.txt")
+	assert.NoFileExists(t, filepath.Join(dir, "repo", "escape.txt"))
+	assert.Contains(t, rep.Results[2].Error.Error(), "/etc/passwd")
+	assert.Contains(t, rep.Results[3].Error.Error(), "../testdata/../../secret.txt")
+}
+
+func TestRunner_RunGroupedFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "group": "greeter", "file": "main.sh", "output_exact": "hello gopher\n" } -->`,
+		"``` sh",
+		". ./lib/greet.sh",
+		"greet gopher",
+		"```",
+		"",
+		`<!-- { "group": "greeter", "file": "lib/greet.sh" } -->`,
+		"``` sh",
+		`greet() { echo "hello $1"; }`,
+		"```",
+	})
+
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_ExtractGroupedFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+	outDir := filepath.Join(dir, "out")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "group": "greeter", "file": "main.sh" } -->`,
+		"``` sh",
+		". ./lib/greet.sh",
+		"```",
+		"",
+		`<!-- { "group": "greeter", "file": "lib/greet.sh" } -->`,
+		"``` sh",
+		`greet() { echo "hello $1"; }`,
+		"```",
+		"",
+		`<!-- { "group": "greeter", "file": "vendor/lib/greet.sh" } -->`,
+		"``` sh",
+		`greet() { echo "vendored"; }`,
+		"```",
+	})
+
+	assert.Nil(t, os.MkdirAll(outDir, 0755))
+
+	runner.noExec = true
+	runner.extractDir = outDir
+	assert.Empty(t, runner.Run())
+
+	for _, name := range []string{"main.sh", "lib/greet.sh", "vendor/lib/greet.sh"} {
+		assert.FileExists(t, filepath.Join(outDir, "001", name))
+	}
+}
+
+func TestRunner_RunHiddenLines(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 2, []string{
+		"<!-- gfmrun:hidden",
+		"greeting=hello",
+		"-->",
+		`<!-- { "output_exact": "hello gopher\n" } -->`,
+		"``` sh",
+		`echo "$greeting gopher"`,
+		"```",
+		"",
+		"<!-- gfmrun:hidden",
+		"mkdir -p out && echo gopher > out/name",
+		"-->",
+		"``` console",
+		"$ cat out/name",
+		"gopher",
+		"```",
+	})
+
+	runner.ShellSessions = true
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunGoWrap(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 3, []string{
+		`<!-- { "output_exact": "HELLO 3\n" } -->`,
+		"``` go",
+		`fmt.Println(strings.ToUpper("hello"), len(os.Args)+2)`,
+		"```",
+		"",
+		`<!-- { "output_exact": "4\n" } -->`,
+		"``` go",
+		"func double(n int) int { return n * 2 }",
+		"",
+		"func main() { fmt.Println(double(2)) }",
+		"```",
+		"",
+		"``` go",
+		"package greet",
+		"",
+		`func Hello() string { return "hello" }`,
+		"```",
+		"",
+		`<!-- { "wrap": false } -->`,
+		"``` go",
+		"undefined()",
+		"```",
+	})
+
+	runner.GoWrap = true
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunGoReplace(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "docs", "EXAMPLES.md")
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "docs"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "vendored", "shout"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/greet\n\ngo 1.18\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "greet.go"), []byte(strings.Join([]string{
+		"package greet",
+		"",
+		`func Hello() string { return "hello from the working tree" }`,
+	}, "\n")), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "vendored", "shout", "go.mod"), []byte("module example.com/shout\n\ngo 1.18\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "vendored", "shout", "shout.go"), []byte(strings.Join([]string{
+		"package shout",
+		"",
+		`import "strings"`,
+		"",
+		`func Shout(s string) string { return strings.ToUpper(s) }`,
+	}, "\n")), 0600))
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "output_exact": "HELLO FROM THE WORKING TREE\n" } -->`,
+		"``` go",
+		"package main",
+		"",
+		"import (",
+		`	"fmt"`,
+		"",
+		`	"example.com/greet"`,
+		`	"example.com/shout"`,
+		")",
+		"",
+		"func main() { fmt.Println(shout.Shout(greet.Hello())) }",
+		"```",
+	})
+
+	t.Setenv("GOPROXY", "off")
+
+	runner.GoReplace = []string{"example.com/shout=" + filepath.Join(dir, "vendored", "shout")}
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunGoWork(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "docs", "EXAMPLES.md")
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "docs"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "greet"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "go.work"), []byte("go 1.18\n\nuse (\n\t./greet\n)\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "greet", "go.mod"), []byte("module example.com/greet\n\ngo 1.18\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "greet", "greet.go"), []byte(strings.Join([]string{
+		"package greet",
+		"",
+		`func Hello() string { return "hello from the workspace" }`,
+	}, "\n")), 0600))
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "output_exact": "hello from the workspace\n" } -->`,
+		"``` go",
+		"package main",
+		"",
+		"import (",
+		`	"fmt"`,
+		"",
+		`	"example.com/greet"`,
+		")",
+		"",
+		"func main() { fmt.Println(greet.Hello()) }",
+		"```",
+	})
+
+	t.Setenv("GOPROXY", "off")
+
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunGoBuildFlags(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "group": "feature", "file": "main.go", "go_tags": ["feature"], "output_exact": "on\n" } -->`,
+		"``` go",
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		"func main() { fmt.Println(feature()) }",
+		"```",
+		"",
+		`<!-- { "group": "feature", "file": "on.go" } -->`,
+		"``` go",
+		"//go:build feature",
+		"",
+		"package main",
+		"",
+		`func feature() string { return "on" }`,
+		"```",
+		"",
+		`<!-- { "group": "feature", "file": "off.go" } -->`,
+		"``` go",
+		"//go:build !feature",
+		"",
+		"package main",
+		"",
+		`func feature() string { return "off" }`,
+		"```",
+	})
+
+	runner.GoFlags = []string{"-trimpath"}
+	assert.Empty(t, runner.Run())
+}
+
+func TestRunner_RunGoSharedModule(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	examples := []string{}
+	for _, word := range []string{"one", "two", "three"} {
+		examples = append(examples,
+			fmt.Sprintf(`<!-- { "output_exact": "%s\n" } -->`, word),
+			"``` go",
+			"package main",
+			"",
+			`import "fmt"`,
+			"",
+			fmt.Sprintf(`func main() { fmt.Println(%q) }`, word),
+			"```",
+			"")
+	}
+
+	examples = append(examples,
+		`<!-- { "go_isolate": true, "output_exact": "isolated\n" } -->`,
+		"``` go",
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		`func main() { fmt.Println("isolated") }`,
+		"```",
+		"",
+		`<!-- { "files": { "greeting.txt": "embedded\n" }, "output_exact": "embedded\n" } -->`,
+		"``` go",
+		"package main",
+		"",
+		"import (",
+		`	_ "embed"`,
+		`	"fmt"`,
+		")",
+		"",
+		"//go:embed greeting.txt",
+		"var greeting string",
+		"",
+		`func main() { fmt.Print(greeting) }`,
+		"```")
+
+	runner := newTestRunner(t, source, 5, examples)
+
+	rep := runner.RunReport()
+	assert.Empty(t, rep.Errors)
+	assert.Greater(t, runner.goTimeSaved, time.Duration(0))
+}
+
+func TestRunner_RunCached(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+	counter := filepath.Join(dir, "runs.txt")
+
+	runner := newTestRunner(t, source, 1, []string{
+		`<!-- { "files": { "greeting.txt": { "path": "testdata/greeting.txt" } }, "output": "hello" } -->`,
+		"``` sh",
+		fmt.Sprintf("echo run >> %s", counter),
+		"cat greeting.txt",
+		"```",
+	})
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "testdata"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "testdata", "greeting.txt"), []byte("hello\n"), 0600))
+
+	runner.cacheDir = filepath.Join(dir, "cache")
+
+	runs := func() int {
+		counterBytes, _ := os.ReadFile(counter)
+		return strings.Count(string(counterBytes), "run")
+	}
+
+	rep := runner.RunReport()
+	assert.Empty(t, rep.Errors)
+	assert.False(t, rep.Results[0].Cached)
+	assert.Equal(t, 1, runs())
+
+	rep = runner.RunReport()
+	assert.Empty(t, rep.Errors)
+	assert.True(t, rep.Results[0].Cached)
+	assert.Equal(t, "hello\n", rep.Results[0].Stdout)
+	assert.Equal(t, 1, runs())
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "testdata", "greeting.txt"), []byte("hello again\n"), 0600))
+
+	rep = runner.RunReport()
+	assert.Empty(t, rep.Errors)
+	assert.False(t, rep.Results[0].Cached)
+	assert.Equal(t, 2, runs())
+
+	runner.NoCache = true
+
+	rep = runner.RunReport()
+	assert.Empty(t, rep.Errors)
+	assert.False(t, rep.Results[0].Cached)
+	assert.Equal(t, 3, runs())
+}
+
+func TestRunner_RunLeakedProcesses(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 2, []string{
+		"``` sh",
+		"sleep 30 >/dev/null 2>&1 &",
+		"echo started",
+		"```",
+		"",
+		`<!-- { "interrupt": "200ms" } -->`,
+		"``` sh",
+		"sleep 30 &",
+		"wait",
+		"```",
+	})
+
+	start := time.Now()
+	rep := runner.RunReport()
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	leakErr := &LeakedProcessesError{}
+	assert.Len(t, rep.Errors, 1)
+	assert.True(t, errors.As(rep.Results[0].Error, &leakErr))
+	assert.Len(t, leakErr.Pids, 1)
+	assert.Equal(t, StatusPass, rep.Results[1].Status)
+}
+
+func TestRunner_RunReadyAndProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 3, []string{
+		fmt.Sprintf(`<!-- { "ready": "listening", "probe": { "url": "%s/ok", "body": "hello from /ok" } } -->`, server.URL),
+		"``` sh",
+		"echo listening",
+		"sleep 30",
+		"```",
+		"",
+		fmt.Sprintf(`<!-- { "ready": "listening", "probe": { "url": "%s/created", "status": 201 } } -->`, server.URL),
+		"``` sh",
+		"echo listening",
+		"sleep 30",
+		"```",
+		"",
+		`<!-- { "ready": "listening" } -->`,
+		"``` sh",
+		"echo starting",
+		"```",
+	})
+
+	start := time.Now()
+	rep := runner.RunReport()
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+
+	probeErr := &ProbeError{}
+	assert.True(t, errors.As(rep.Results[1].Error, &probeErr))
+
+	readyErr := &ReadyError{}
+	assert.True(t, errors.As(rep.Results[2].Error, &readyErr))
+	assert.True(t, readyErr.Exited)
+}
+
+func TestRunner_RunServices(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+	state := filepath.Join(dir, "state")
+
+	runner := newTestRunner(t, source, 5, []string{
+		fmt.Sprintf(`<!-- { "service": "server", "ready": "started", "env": { "STATE": %q } } -->`, state),
+		"``` sh",
+		`trap 'kill $!; echo stopped > "$STATE"; exit 0' INT`,
+		`echo running > "$STATE"`,
+		"echo started",
+		"sleep 30 &",
+		"wait",
+		"```",
+		"",
+		fmt.Sprintf(`<!-- { "needs": "server", "output": "running", "env": { "STATE": %q } } -->`, state),
+		"``` sh",
+		`cat "$STATE"`,
+		"```",
+		"",
+		`<!-- { "service": "broken", "ready": "started" } -->`,
+		"``` sh",
+		"exit 1",
+		"```",
+		"",
+		`<!-- { "needs": ["server", "broken"] } -->`,
+		"``` sh",
+		"echo unreachable",
+		"```",
+		"",
+		`<!-- { "needs": "later" } -->`,
+		"``` sh",
+		"echo unreachable",
+		"```",
+	})
+
+	runner.Concurrency = 2
+
+	start := time.Now()
+	rep := runner.RunReport()
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+	assert.Equal(t, StatusPass, rep.Results[1].Status)
+	assert.Equal(t, StatusFail, rep.Results[2].Status)
+	assert.Equal(t, StatusSkip, rep.Results[3].Status)
+	assert.Equal(t, StatusFail, rep.Results[4].Status)
+
+	stateBytes, err := os.ReadFile(state)
+	assert.Nil(t, err)
+	assert.Equal(t, "stopped\n", string(stateBytes))
+}
+
+func TestRunner_RunServiceCrashed(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 2, []string{
+		`<!-- { "service": "crashing", "ready": "started" } -->`,
+		"``` sh",
+		"echo started",
+		"sleep 0.2",
+		"exit 3",
+		"```",
+		"",
+		`<!-- { "needs": "crashing" } -->`,
+		"``` sh",
+		"sleep 0.5",
+		"```",
+	})
+
+	rep := runner.RunReport()
+	assert.Len(t, rep.Errors, 1)
+	assert.Equal(t, StatusFail, rep.Results[0].Status)
+	assert.Contains(t, rep.Results[0].Error.Error(), `service "crashing" exited before it was stopped`)
+	assert.Equal(t, StatusPass, rep.Results[1].Status)
+}
+
+func TestRunner_RunServicesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	lines := []string{
+		`<!-- { "service": "server", "ready": "started" } -->`,
+		"``` sh",
+		"echo started",
+		"exec sleep 30",
+		"```",
+	}
+
+	for j := 0; j < 12; j++ {
+		lines = append(lines,
+			"",
+			fmt.Sprintf(`<!-- { "needs": "server", "output": "client %d" } -->`, j),
+			"``` sh",
+			fmt.Sprintf("echo client %d", j),
+			"```")
+	}
+
+	runner := newTestRunner(t, source, 13, lines)
+
+	runner.Concurrency = 8
+
+	rep := runner.RunReport()
+
+	assert.Len(t, rep.Errors, 0)
+	assert.Len(t, rep.Failed(), 0)
+	assert.Len(t, rep.Skipped(), 0)
+}
+
+func TestRunner_RunSessions(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 6, []string{
+		`<!-- { "session": { "name": "tutorial", "shell": true } } -->`,
+		"``` sh",
+		"trap 'echo mine' EXIT",
+		"mkdir notes && cd notes",
+		"echo one > todo.txt",
+		"export COUNT=1",
+		"```",
+		"",
+		`<!-- { "session": { "name": "tutorial", "shell": true }, "output": "count=1\\none\\ntwo" } -->`,
+		"``` bash",
+		"echo two >> todo.txt",
+		`echo "count=${COUNT}"`,
+		"cat todo.txt",
+		"```",
+		"",
+		`<!-- { "session": "other" } -->`,
+		"``` sh",
+		"test ! -e notes",
+		"```",
+		"",
+		`<!-- { "session": "tutorial", "output": "^one\\ntwo\\n$" } -->`,
+		"``` sh",
+		"cat notes/todo.txt",
+		"```",
+		"",
+		`<!-- { "session": "tutorial" } -->`,
+		"``` sh",
+		"exit 1",
+		"```",
+		"",
+		`<!-- { "session": "tutorial" } -->`,
+		"``` sh",
+		"echo unreachable",
+		"```",
+	})
+
+	rep := runner.RunReport()
+	assert.Equal(t, "mine\n", rep.Results[0].Stdout)
+
+	for j, status := range []Status{StatusPass, StatusPass, StatusPass, StatusPass, StatusFail, StatusSkip} {
+		assert.Equal(t, status, rep.Results[j].Status, fmt.Sprintf("example %d: %v", j, rep.Results[j].Error))
+	}
+}
+
+func TestRunner_RunInterruptSignals(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	runner := newTestRunner(t, source, 6, []string{
+		`<!-- { "interrupt": { "after": "200ms", "signals": ["TERM"], "expect_clean_exit": true }, "output": "bye" } -->`,
+		"``` sh",
+		`trap 'echo bye; exit 0' TERM`,
+		"sleep 30 &",
+		"wait",
+		"```",
+		"",
+		`<!-- { "interrupt": { "after": "200ms", "signals": ["SIGTERM"], "expect_clean_exit": true } } -->`,
+		"``` sh",
+		"sleep 30 &",
+		"wait",
+		"```",
+		"",
+		`<!-- { "interrupt": { "after": "200ms", "signals": ["TERM"], "grace": "200ms", "expect_clean_exit": true } } -->`,
+		"``` sh",
+		"trap '' TERM",
+		"sleep 30 &",
+		"wait",
+		"```",
+		"",
+		`<!-- { "interrupt": { "signals": ["NOPE"] } } -->`,
+		"``` sh",
+		"echo unreachable",
+		"```",
+		"",
+		`<!-- { "interrupt": { "after": "5s", "signals": ["TERM"], "expect_clean_exit": true } } -->`,
+		"``` sh",
+		"exit 4",
+		"```",
+		"",
+		`<!-- { "service": "svc", "ready": "started", "interrupt": { "signals": ["TERM"], "expect_clean_exit": true } } -->`,
+		"``` sh",
+		"echo started",
+		"sleep 30 &",
+		"wait",
+		"```",
+	})
+
+	start := time.Now()
+	rep := runner.RunReport()
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	assert.Equal(t, StatusPass, rep.Results[0].Status)
+
+	for j, signals := range map[int][]string{1: {"TERM"}, 2: {"TERM", "KILL"}, 5: {"TERM"}} {
+		uncleanErr := &UncleanExitError{}
+		assert.True(t, errors.As(rep.Results[j].Error, &uncleanErr), fmt.Sprintf("example %d: %v", j, rep.Results[j].Error))
+		assert.Equal(t, signals, uncleanErr.Signals)
+	}
+
+	assert.Equal(t, StatusFail, rep.Results[3].Status)
+
+	exitErr := &ExitError{}
+	assert.True(t, errors.As(rep.Results[4].Error, &exitErr))
+	assert.Equal(t, 4, exitErr.Retcode)
+	assert.False(t, errors.As(rep.Results[4].Error, new(*UncleanExitError)))
+}
+
+// newTestRunner writes the lines to the markdown source and returns a runner
+// of it expecting count examples, with the default languages
+func newTestRunner(t *testing.T, source string, count int, lines []string) *Runner {
+	t.Helper()
+
+	assert.Nil(t, os.MkdirAll(filepath.Dir(source), 0755))
+	assert.Nil(t, os.WriteFile(source, []byte(strings.Join(lines, "\n")), 0600))
+
+	runner, err := NewRunner([]string{source}, count, filepath.Join(filepath.Dir(source), "languages.yml"), false, testLog)
+	assert.Nil(t, err)
+
+	return runner
+}
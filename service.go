@@ -0,0 +1,133 @@
+package gfmrun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// service is the program of an example with a "service" tag that is left
+// running in the background for the examples after it that need it
+type service struct {
+	Name   string
+	cmd    *exec.Cmd
+	waitCh chan error
+	tmpDir string
+}
+
+// ServiceName returns the name of the "service" tag, or "" when the example is
+// not a service
+func (rn *Runnable) ServiceName() string {
+	rn.parseTags()
+	name, _ := rn.Tags["service"].(string)
+	return name
+}
+
+// Needs returns the names of the services of the "needs" tag, which is a
+// string or array of strings
+func (rn *Runnable) Needs() []string {
+	rn.parseTags()
+
+	needs := []string{}
+
+	switch v := rn.Tags["needs"].(type) {
+	case string:
+		if v != "" {
+			needs = append(needs, v)
+		}
+	case []interface{}:
+		for _, iv := range v {
+			if s, ok := iv.(string); ok && s != "" {
+				needs = append(needs, s)
+			}
+		}
+	}
+
+	return needs
+}
+
+// startService starts the command and, for an example with a "ready" or
+// "probe" tag, waits for it to be ready and probed, leaving it running unless
+// it exits or fails to become ready, in which case it is interrupted
+func (rn *Runnable) startService(ctx context.Context, cmd *exec.Cmd, stdout, stderr io.Writer, output fmt.Stringer) *started {
+	wait, err := startCommand(cmd, stdout, stderr)
+	if err != nil {
+		return &started{Err: err}
+	}
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- wait() }()
+
+	var probeErr error
+	if rn.IsProbed() {
+		probeErr = rn.awaitProbed(ctx, waitCh, output)
+	}
+
+	select {
+	case err := <-waitCh:
+		return &started{Err: err, ProbeErr: probeErr}
+	default:
+	}
+
+	if probeErr != nil {
+		signals, err := rn.interrupt(ctx, cmd, waitCh)
+		return &started{Err: err, ProbeErr: probeErr, Signals: signals}
+	}
+
+	rn.service = &service{Name: rn.ServiceName(), cmd: cmd, waitCh: waitCh}
+	return &started{}
+}
+
+// stopService interrupts the running service of the example via increasingly
+// serious signals and removes its temporary files, returning an error when it
+// had exited before being stopped, left processes running, or did not exit
+// cleanly with an "interrupt" tag that expects it to
+func (rn *Runnable) stopService(ctx context.Context) error {
+	svc := rn.service
+	if svc == nil {
+		return nil
+	}
+
+	rn.service = nil
+
+	defer func() {
+		if os.Getenv("GFMRUN_PRESERVE_TMPFILES") == "1" || svc.tmpDir == "" {
+			return
+		}
+		_ = os.RemoveAll(svc.tmpDir)
+	}()
+
+	var exitErr error
+
+	select {
+	case err := <-svc.waitCh:
+		exitErr = fmt.Errorf("service %q exited before it was stopped", svc.Name)
+		if err != nil {
+			exitErr = fmt.Errorf("service %q exited before it was stopped: %w", svc.Name, err)
+		}
+		svc.waitCh <- err
+	default:
+	}
+
+	signals, err := rn.interrupt(ctx, svc.cmd, svc.waitCh)
+
+	if leakErr := rn.reapProcessGroup(svc.cmd); leakErr != nil {
+		return leakErr
+	}
+
+	if exitErr != nil {
+		return exitErr
+	}
+
+	if intr, _ := rn.Interruption(); err != nil && intr != nil && intr.ExpectCleanExit {
+		if ee, ok := err.(*exec.ExitError); ok {
+			err = &ExitError{Retcode: ee.ExitCode(), Err: ee}
+		}
+
+		return &UncleanExitError{Signals: signals, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package gfmrun
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// sessionEnvLineRe matches the start of a variable in the output of env,
+	// including functions exported by bash
+	sessionEnvLineRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(%%)?=`)
+
+	// sessionEnvIgnored are variables that shells set for themselves
+	sessionEnvIgnored = map[string]bool{
+		"OLDPWD": true,
+		"PWD":    true,
+		"SHLVL":  true,
+		"_":      true,
+	}
+
+	sessionShellExtensions = map[string]bool{
+		"bash": true,
+		"sh":   true,
+		"zsh":  true,
+	}
+)
+
+// session is shared by the examples of a source with the same "session" tag,
+// which are run one after another from a single working directory
+type session struct {
+	Name string
+	Dir  string
+
+	// WorkDir and Env are the working directory and the exported variables
+	// left behind by the last shell example of the session
+	WorkDir string
+	Env     []string
+
+	// FailedLine is the line of the first example of the session that failed
+	FailedLine int
+}
+
+func newSession(name string) (*session, error) {
+	baseTmp := filepath.Join(os.TempDir(), "gfmrun")
+	if err := os.MkdirAll(baseTmp, 0755); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(baseTmp, "session.*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{Name: name, Dir: dir}, nil
+}
+
+// Remove removes the session directory unless temporary files are preserved
+func (s *session) Remove() {
+	if s == nil || os.Getenv("GFMRUN_PRESERVE_TMPFILES") == "1" {
+		return
+	}
+
+	_ = os.RemoveAll(s.Dir)
+}
+
+// SessionName returns the name of the "session" tag, which is either a string
+// or an object with a "name", or "" when the example is not part of a session
+func (rn *Runnable) SessionName() string {
+	rn.parseTags()
+
+	switch v := rn.Tags["session"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		name, _ := v["name"].(string)
+		return name
+	}
+
+	return ""
+}
+
+// SessionShell is true when the "session" tag is an object with a truthy
+// "shell" and the example is a bash, sh, or zsh script, so that it picks up
+// the exported variables and working directory left by the shell example of
+// the session before it
+func (rn *Runnable) SessionShell() bool {
+	rn.parseTags()
+
+	v, ok := rn.Tags["session"].(map[string]interface{})
+	if !ok || rn.Frob == nil {
+		return false
+	}
+
+	shell, _ := v["shell"].(bool)
+	return shell && sessionShellExtensions[rn.Frob.Extension()]
+}
+
+// sessionShellWrapper is run in place of a shell example of a session, which
+// it sources so that the working directory and environment the example leaves
+// behind may be saved to the state file, even when the example sets an EXIT
+// trap of its own
+const sessionShellWrapper = `. "$GFMRUN_FILE"
+status=$?
+{ pwd; env; } > "$GFMRUN_SESSION_STATE"
+exit $status
+`
+
+// load reads the working directory and environment saved by a shell example,
+// keeping the variables that the example added or changed from baseEnv
+func (s *session) load(stateFile string, baseEnv []string) {
+	stateBytes, err := os.ReadFile(stateFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(stateBytes), "\n"), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return
+	}
+
+	base := map[string]string{}
+	for _, pair := range baseEnv {
+		key, value, _ := strings.Cut(pair, "=")
+		base[key] = value
+	}
+
+	pairs := []string{}
+	for _, line := range lines[1:] {
+		if sessionEnvLineRe.MatchString(line) || len(pairs) == 0 {
+			pairs = append(pairs, line)
+			continue
+		}
+
+		// values that span lines
+		pairs[len(pairs)-1] += "\n" + line
+	}
+
+	env := []string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || sessionEnvIgnored[key] || strings.HasPrefix(key, "GFMRUN_") {
+			continue
+		}
+
+		if baseValue, ok := base[key]; !ok || baseValue != value {
+			env = append(env, pair)
+		}
+	}
+
+	s.WorkDir = lines[0]
+	s.Env = env
+}
@@ -0,0 +1,46 @@
+package gfmrun
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession_Load(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state")
+
+	assert.Nil(t, os.WriteFile(stateFile, []byte(strings.Join([]string{
+		"/tmp/gfmrun/session.1/notes",
+		"HOME=/home/gopher",
+		"LANG=fr_FR.UTF-8",
+		"COUNT=1",
+		"MESSAGE=first",
+		"second",
+		"BASH_FUNC_greet%%=() {  echo hello",
+		"}",
+		"PWD=/tmp/gfmrun/session.1/notes",
+		"OLDPWD=/tmp/gfmrun/session.1",
+		"SHLVL=2",
+		"GFMRUN_FILE=session-wrapper.sh",
+		"",
+	}, "\n")), 0600))
+
+	s := &session{Name: "tutorial", Dir: dir}
+	s.load(stateFile, []string{"HOME=/home/gopher", "LANG=C.UTF-8"})
+
+	assert.Equal(t, "/tmp/gfmrun/session.1/notes", s.WorkDir)
+	assert.Equal(t, []string{
+		"LANG=fr_FR.UTF-8",
+		"COUNT=1",
+		"MESSAGE=first\nsecond",
+		"BASH_FUNC_greet%%=() {  echo hello\n}",
+	}, s.Env)
+
+	s.load(filepath.Join(dir, "missing"), nil)
+	assert.Equal(t, "/tmp/gfmrun/session.1/notes", s.WorkDir)
+	assert.Len(t, s.Env, 4)
+}
@@ -0,0 +1,121 @@
+package gfmrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MarkdownTest runs the examples in markdown sources as Go subtests
+type MarkdownTest struct {
+	// Languages is the location of the languages.yml file from linguist,
+	// defaulting to DefaultLanguagesYml
+	Languages string
+	// AutoPull enables downloading languages.yml when it is missing
+	AutoPull bool
+	// Parallel runs each example subtest in parallel with the others
+	Parallel bool
+	// Timeout is the default maximum duration of each example
+	Timeout time.Duration
+	// Log receives log output, which is discarded when nil
+	Log *logrus.Logger
+}
+
+// TestMarkdown runs every example in the given markdown sources as a subtest
+// named by the base name of the source file, line, and language, e.g.
+// "README.md:L42-go", so that examples may be verified via `go test` and
+// filtered via `-run`
+func TestMarkdown(t *testing.T, sources ...string) {
+	t.Helper()
+	(&MarkdownTest{}).Run(t, sources...)
+}
+
+// Run runs every example in the given markdown sources as a subtest.  Examples
+// that would be skipped by a Runner are skipped via t.Skip, as are examples
+// with an "interrupt" tag when testing with `-short`.  Examples with a
+// "service", "needs", or "session" tag are skipped as well, as they depend on
+// other examples of the source, which a Runner runs them along with.
+func (mt *MarkdownTest) Run(t *testing.T, sources ...string) {
+	t.Helper()
+
+	log := mt.Log
+	if log == nil {
+		log = logrus.New()
+		log.Out = io.Discard
+	}
+
+	runner, err := NewRunner(sources, 0, mt.Languages, mt.AutoPull, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Timeout = mt.Timeout
+
+	for i, sourceFile := range sources {
+		sourceBytes, err := os.ReadFile(sourceFile)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		for j, runnable := range runner.findRunnables(i, sourceFile, string(sourceBytes)) {
+			j, runnable := j, runnable
+
+			t.Run(markdownTestName(runnable), func(t *testing.T) {
+				if mt.Parallel {
+					t.Parallel()
+				}
+
+				if runnable.ServiceName() != "" || len(runnable.Needs()) > 0 {
+					t.Skip("skipping example with a service or needs tag, which only a Runner supports")
+				}
+
+				if runnable.SessionName() != "" {
+					t.Skip("skipping example with a session tag, which only a Runner supports")
+				}
+
+				if interruptable, _ := runnable.Interruptable(); interruptable && testing.Short() {
+					t.Skip("skipping long-running example in short mode")
+				}
+
+				ctx := context.Background()
+				if deadline, ok := t.Deadline(); ok {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithDeadline(ctx, deadline)
+					defer cancel()
+				}
+
+				outBuf := &bytes.Buffer{}
+				runnable.stdout = outBuf
+				runnable.stderr = outBuf
+
+				res := runnable.RunContext(ctx, j)
+
+				switch res.Status {
+				case StatusSkip:
+					t.Skip(res.SkipReason)
+				case StatusFail:
+					if outBuf.Len() > 0 {
+						t.Logf("setup output:\n%s", outBuf.String())
+					}
+					t.Logf("stdout:\n%s", res.Stdout)
+					t.Logf("stderr:\n%s", res.Stderr)
+					t.Error(res.Error)
+				}
+			})
+		}
+	}
+}
+
+// markdownTestName names the subtest of an example like Runnable.Name, but
+// without the directory of the source file, as slashes would nest subtests
+func markdownTestName(rn *Runnable) string {
+	return fmt.Sprintf("%s:L%d-%s", filepath.Base(rn.SourceFile), rn.LineOffset, rn.Lang)
+}
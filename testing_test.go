@@ -0,0 +1,111 @@
+package gfmrun
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	err := os.WriteFile(source, []byte(strings.Join([]string{
+		`<!-- { "output": "^ohai\n$" } -->`,
+		"``` sh",
+		"echo ohai",
+		"```",
+		"",
+		`<!-- { "os": "plan9" } -->`,
+		"``` sh",
+		"exit 1",
+		"```",
+	}, "\n")), 0600)
+	assert.Nil(t, err)
+
+	(&MarkdownTest{
+		Languages: filepath.Join(dir, "languages.yml"),
+		Parallel:  true,
+		Log:       testLog,
+	}).Run(t, source)
+}
+
+// TestTestMarkdownResults runs a failing markdown test in a test binary of its
+// own, as a failing subtest would otherwise fail this test as well
+func TestTestMarkdownResults(t *testing.T) {
+	if source := os.Getenv("GFMRUN_TEST_MARKDOWN_SOURCE"); source != "" {
+		(&MarkdownTest{
+			Languages: filepath.Join(filepath.Dir(source), "languages.yml"),
+			Log:       testLog,
+		}).Run(t, source)
+		return
+	}
+
+	dir := filepath.Join(t.TempDir(), "docs")
+	source := filepath.Join(dir, "EXAMPLES.md")
+
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, os.WriteFile(source, []byte(strings.Join([]string{
+		"``` sh",
+		"echo ohai",
+		"```",
+		"",
+		`<!-- { "os": "plan9" } -->`,
+		"``` sh",
+		"exit 1",
+		"```",
+		"",
+		"``` sh",
+		"exit 3",
+		"```",
+		"",
+		`<!-- { "service": "server", "ready": "started" } -->`,
+		"``` sh",
+		"echo started",
+		"exec sleep 97",
+		"```",
+		"",
+		`<!-- { "needs": "server" } -->`,
+		"``` sh",
+		"echo client",
+		"```",
+		"",
+		`<!-- { "session": "tutorial" } -->`,
+		"``` sh",
+		"mkdir notes",
+		"```",
+		"",
+		`<!-- { "session": "tutorial" } -->`,
+		"``` sh",
+		"test -d notes",
+		"```",
+	}, "\n")), 0600))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestTestMarkdownResults$", "-test.v")
+	cmd.Env = append(os.Environ(), "GFMRUN_TEST_MARKDOWN_SOURCE="+source)
+
+	out, err := cmd.CombinedOutput()
+	assert.NotNil(t, err)
+	assert.Contains(t, string(out), "--- PASS: TestTestMarkdownResults/EXAMPLES.md:L1-sh")
+	assert.Contains(t, string(out), "--- SKIP: TestTestMarkdownResults/EXAMPLES.md:L6-sh")
+	assert.Contains(t, string(out), "os not supported")
+	assert.Contains(t, string(out), "--- FAIL: TestTestMarkdownResults/EXAMPLES.md:L10-sh")
+	assert.Contains(t, string(out), "exit status 3")
+	assert.Contains(t, string(out), "--- SKIP: TestTestMarkdownResults/EXAMPLES.md:L15-sh")
+	assert.Contains(t, string(out), "--- SKIP: TestTestMarkdownResults/EXAMPLES.md:L21-sh")
+	assert.Contains(t, string(out), "only a Runner supports")
+	assert.Contains(t, string(out), "--- SKIP: TestTestMarkdownResults/EXAMPLES.md:L26-sh")
+	assert.Contains(t, string(out), "--- SKIP: TestTestMarkdownResults/EXAMPLES.md:L31-sh")
+	assert.Contains(t, string(out), "skipping example with a session tag")
+
+	cmd = exec.Command(os.Args[0], "-test.run=^TestTestMarkdownResults$/^EXAMPLES.md:L1-sh$", "-test.v")
+	cmd.Env = append(os.Environ(), "GFMRUN_TEST_MARKDOWN_SOURCE="+source)
+
+	out, err = cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.NotContains(t, string(out), "EXAMPLES.md:L10-sh")
+}